@@ -1,5 +1,7 @@
 package discovery
 
+import "cmp"
+
 // Manifest represents the discovered components for a given application.
 type Manifest struct {
 	DiscoveredImages []DiscoveredImage
@@ -13,11 +15,93 @@ type DiscoveredImage struct {
 	// Containers is a list of DiscoveredContainer objects which are using
 	// the discovered image.
 	Containers []DiscoveredContainer
+
+	// Category classifies who provides the image, e.g. ImageCategoryProduct.
+	// It is only populated when images are categorized by registry rules.
+	Category ImageCategory `json:",omitempty"`
+
+	// Inspection holds what the image's registry reports about it. It is
+	// only populated when registries are inspected.
+	Inspection *ImageInspection `json:",omitempty"`
+
+	// RequiredPlatforms lists the platforms, e.g. "linux/amd64", of the
+	// nodes on which the image's containers ran. It is only populated when
+	// node platforms are resolved.
+	RequiredPlatforms []string `json:",omitempty"`
+
+	// ImageStream is the OpenShift ImageStream tag or image, e.g.
+	// "ns/name:tag", which an image in the internal registry belongs to.
+	ImageStream string `json:",omitempty"`
+
+	// SourceImage is the external image an ImageStream imported Image from.
+	// It is only populated for images in the OpenShift internal registry
+	// which were resolved to their ImageStream.
+	SourceImage string `json:",omitempty"`
+
+	// CanonicalImage is the image which Image, or its SourceImage, is a mirror
+	// of, or is itself when it names the source. It is only populated when
+	// ImageDigestMirrorSets, ImageTagMirrorSets or ImageContentSourcePolicies
+	// are read, and one of them applies to the image.
+	CanonicalImage string `json:",omitempty"`
+
+	// MirrorImages are the locations CanonicalImage is mirrored to.
+	MirrorImages []string `json:",omitempty"`
 }
 
+// Origin returns the image Image was obtained from: its CanonicalImage or
+// SourceImage if either is known, and otherwise Image itself.
+func (i DiscoveredImage) Origin() string {
+	return cmp.Or(i.CanonicalImage, i.SourceImage, i.Image)
+}
+
+// ImageInspection is what a registry reports about an image.
+type ImageInspection struct {
+	// Digest is the digest of the manifest or index the image resolves to.
+	Digest string `json:",omitempty"`
+
+	// MediaType is the media type of the manifest or index.
+	MediaType string `json:",omitempty"`
+
+	// MultiArch is true if the image is an index of manifests for several
+	// platforms.
+	MultiArch bool `json:",omitempty"`
+
+	// Platforms lists the os/architecture[/variant] platforms the image
+	// provides, e.g. "linux/amd64".
+	Platforms []string `json:",omitempty"`
+
+	// Labels holds the config labels certification checks, such as name,
+	// vendor and version.
+	Labels map[string]string `json:",omitempty"`
+
+	// Error describes why the image could not be inspected.
+	Error string `json:",omitempty"`
+}
+
+// ImageCategory classifies who provides an image.
+type ImageCategory = string
+
+const (
+	// ImageCategoryProduct is an image built for the product itself, which
+	// must be certified.
+	ImageCategoryProduct ImageCategory = "product"
+
+	// ImageCategoryRedHat is an image provided by Red Hat, such as a base
+	// image from registry.redhat.io.
+	ImageCategoryRedHat ImageCategory = "red-hat"
+
+	// ImageCategoryPlatform is an image of the platform the product runs on,
+	// such as an OpenShift component.
+	ImageCategoryPlatform ImageCategory = "platform"
+
+	// ImageCategoryThirdParty is an image from any other upstream or vendor.
+	ImageCategoryThirdParty ImageCategory = "third-party"
+)
+
 // DiscoveredContainer is a container which was observed during the discovery process.
 type DiscoveredContainer struct {
-	// Name is the name of a container in a pod.
+	// Name is the name of a container in a pod, or of the volume for
+	// ContainerTypeImageVolume.
 	Name string
 
 	// Type is the ContainerType of the container in its pod.
@@ -25,6 +109,71 @@ type DiscoveredContainer struct {
 
 	// Pod is the DiscoveredPod which this container is a part of.
 	Pod DiscoveredPod
+
+	// PullPolicy is the pull policy of an image volume. It is not recorded
+	// for containers.
+	PullPolicy string `json:",omitempty"`
+
+	// ReferencedBy is empty if the container was observed running the image.
+	// Otherwise, the container only references the image, and ReferencedBy
+	// describes where the reference was found, e.g. "env:RELATED_IMAGE_DB".
+	ReferencedBy string `json:",omitempty"`
+
+	// Sources lists the discovery runs or clusters in which this container
+	// was observed. It is only populated when a source name was provided, or
+	// when manifests are merged.
+	Sources []string `json:",omitempty"`
+
+	// InjectedBy names the service mesh or webhook which injected the
+	// container into its pod, e.g. "istio". It is empty for containers which
+	// are part of the workload itself.
+	InjectedBy string `json:",omitempty"`
+
+	// Component identifies the operator or Helm release which deployed the
+	// container. It is only populated when attribution is enabled and the
+	// pod, or one of its owners, carries OLM or Helm metadata.
+	Component *Component `json:",omitempty"`
+
+	// Platform is the platform of the node the container's pod was
+	// scheduled on, e.g. "linux/arm64". It is only populated when node
+	// platforms are resolved.
+	Platform string `json:",omitempty"`
+}
+
+// IsReference reports whether the container only references the image,
+// rather than running it.
+func (c DiscoveredContainer) IsReference() bool {
+	return c.ReferencedBy != ""
+}
+
+// Component is the product component a container belongs to, as recorded by
+// OLM or Helm on the container's pod and its owners.
+type Component struct {
+	// ClusterServiceVersion is the name of the operator CSV which owns the
+	// workload, from the olm.owner label.
+	ClusterServiceVersion string `json:",omitempty"`
+
+	// ClusterServiceVersionNamespace is the namespace of the CSV, from the
+	// olm.owner.namespace label.
+	ClusterServiceVersionNamespace string `json:",omitempty"`
+
+	// Operator is the name of the OLM Operator, from the
+	// operators.coreos.com/<name> label.
+	Operator string `json:",omitempty"`
+
+	// HelmRelease is the name of the Helm release which installed the
+	// workload.
+	HelmRelease string `json:",omitempty"`
+
+	// HelmReleaseNamespace is the namespace of the Helm release.
+	HelmReleaseNamespace string `json:",omitempty"`
+
+	// HelmChart is the name of the chart, from the helm.sh/chart label.
+	HelmChart string `json:",omitempty"`
+
+	// HelmChartVersion is the version of the chart, from the helm.sh/chart
+	// label.
+	HelmChartVersion string `json:",omitempty"`
 }
 
 // ContainerType is the type of a container in a pod.
@@ -34,6 +183,14 @@ const (
 	ContainerTypeStandard  ContainerType = "Container"
 	ContainerTypeInit      ContainerType = "InitContainer"
 	ContainerTypeEphemeral ContainerType = "EphemeralContainer"
+
+	// ContainerTypeSidecar is an init container with a restartPolicy of
+	// Always, which keeps running next to the pod's containers.
+	ContainerTypeSidecar ContainerType = "SidecarContainer"
+
+	// ContainerTypeImageVolume is an image volume, which mounts the content
+	// of an OCI image or artifact into the pod rather than running it.
+	ContainerTypeImageVolume ContainerType = "ImageVolume"
 )
 
 // DiscoveredPod is a pod that contains a discovered image.
@@ -5,7 +5,36 @@ import (
 	"errors"
 )
 
+const (
+	// ExitCodeFailure is the process exit code used for general failures.
+	ExitCodeFailure = 1
+
+	// ExitCodeDifferences is the process exit code used when compared
+	// manifests differ, or a manifest does not match its baseline.
+	ExitCodeDifferences = 2
+)
+
+var (
+	// ErrDifferencesFound indicates that the compared manifests are not
+	// equivalent. The differences themselves have already been reported.
+	ErrDifferencesFound = errors.New("differences found")
+
+	// ErrBaselineCheckFailed indicates that a manifest contains images that
+	// are not part of its baseline, or is missing some of them. The report
+	// has already been written.
+	ErrBaselineCheckFailed = errors.New("baseline check failed")
+)
+
 // IsTimeout
 func IsTimeout(err error) bool {
 	return errors.Is(err, context.DeadlineExceeded)
 }
+
+// ExitCode returns the process exit code that should be used for err.
+func ExitCode(err error) int {
+	if errors.Is(err, ErrDifferencesFound) || errors.Is(err, ErrBaselineCheckFailed) {
+		return ExitCodeDifferences
+	}
+
+	return ExitCodeFailure
+}
@@ -0,0 +1,83 @@
+package discoverworkload
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/discover"
+	"github.com/opdev/discover-workload/internal/olm"
+)
+
+const (
+	bundleShortDesc = "Produce a manifest of the images declared by operator bundles or file-based catalogs."
+	bundleLongDesc  = bundleShortDesc + `
+
+Each path is a bundle directory, holding manifests/*.clusterserviceversion.yaml,
+or a file-based catalog directory. The images of the CSV's deployments, their
+RELATED_IMAGE_* environment variables, and the relatedImages of the CSV or of
+each catalog bundle are written as a manifest, which can be compared with a
+discovery run using the diff subcommand.`
+)
+
+type bundleConfig struct {
+	CompactOutput bool
+	Sort          string
+	EnvImageRegex string
+}
+
+func newBundleCommand(rootCfg *config) *cobra.Command {
+	cfg := &bundleConfig{}
+
+	c := &cobra.Command{
+		Use:   "bundle [flags] path...",
+		Short: bundleShortDesc,
+		Long:  bundleLongDesc,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := newLogger(rootCfg.LogLevel, os.Stderr)
+			if err != nil {
+				return fmt.Errorf("failed to build a logger: %w", err)
+			}
+
+			sortOrder, err := discover.ParseSortOrder(cfg.Sort)
+			if err != nil {
+				logger.Error("failed to parse sort order", "sortValue", cfg.Sort)
+				return err
+			}
+
+			envImagePattern, err := parseEnvImagePattern(cfg.EnvImageRegex)
+			if err != nil {
+				logger.Error("failed to parse environment variable image pattern", "patternValue", cfg.EnvImageRegex)
+				return err
+			}
+
+			manifests := make([]discovery.Manifest, 0, len(args))
+			for _, path := range args {
+				m, err := olm.ReadManifestFromPath(path, envImagePattern, logger)
+				if err != nil {
+					logger.Error("failed to read the bundle or catalog", "path", path, "errMsg", err)
+					return err
+				}
+				manifests = append(manifests, m)
+			}
+
+			m := discover.SortManifest(discover.MergeManifests(manifests...), sortOrder)
+			if err := discover.WriteManifest(cmd.OutOrStdout(), m, cfg.CompactOutput); err != nil {
+				logger.Error("unable to write output manifest", "errMsg", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	flags := c.Flags()
+	flags.BoolVarP(&cfg.CompactOutput, "compact", "c", false, "Print JSON in compact format instead of pretty-printed output")
+	flags.StringVar(&cfg.Sort, "sort", discover.SortByImage, fmt.Sprintf("How to order the manifest before it is printed. One of %v.", discover.SortOrders))
+	flags.StringVar(&cfg.EnvImageRegex, "env-image-pattern", discover.DefaultEnvImagePattern, "Container environment variables whose names match this regular expression are recorded as referenced images. An empty value disables this.")
+
+	return c
+}
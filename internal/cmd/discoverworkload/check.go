@@ -0,0 +1,130 @@
+package discoverworkload
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/apperrors"
+	"github.com/opdev/discover-workload/internal/discover"
+)
+
+const (
+	checkShortDesc = "Check a manifest against a baseline of allowed images."
+	checkLongDesc  = checkShortDesc + `
+
+Reports discovered images that are not part of the baseline manifest, and
+optionally baseline images that were not discovered. The report is written as
+JSON, and the command exits with code 2 if the check fails.`
+)
+
+type checkConfig struct {
+	BaselinePath  string
+	FailOnMissing bool
+}
+
+func newCheckCommand(rootCfg *config) *cobra.Command {
+	cfg := &checkConfig{}
+
+	c := &cobra.Command{
+		Use:   "check [flags] --baseline baseline.json manifest.json",
+		Short: checkShortDesc,
+		Long:  checkLongDesc,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := newLogger(rootCfg.LogLevel, os.Stderr)
+			if err != nil {
+				return fmt.Errorf("failed to build a logger: %w", err)
+			}
+
+			discovered, err := discover.ReadManifestFile(args[0])
+			if err != nil {
+				logger.Error("failed to read manifest", "path", args[0], "errMsg", err)
+				return err
+			}
+
+			return checkBaseline(cmd, logger, cfg.BaselinePath, discovered, cfg.FailOnMissing, cmd.OutOrStdout())
+		},
+	}
+
+	flags := c.Flags()
+	flags.StringVar(&cfg.BaselinePath, "baseline", "", "The manifest of allowed images to check against.")
+	flags.BoolVar(&cfg.FailOnMissing, "fail-on-missing", false, "Also fail if images in the baseline were not discovered.")
+	_ = c.MarkFlagRequired("baseline")
+
+	return c
+}
+
+// checkBaseline compares discovered against the baseline manifest stored at
+// baselinePath, and writes the report to reportOut. ErrBaselineCheckFailed is
+// returned if the check fails.
+func checkBaseline(
+	cmd *cobra.Command,
+	logger *slog.Logger,
+	baselinePath string,
+	discovered discovery.Manifest,
+	failOnMissing bool,
+	reportOut io.Writer,
+) error {
+	baseline, err := discover.ReadManifestFile(baselinePath)
+	if err != nil {
+		logger.Error("failed to read baseline manifest", "path", baselinePath, "errMsg", err)
+		return err
+	}
+
+	report := discover.CheckBaseline(baseline, discovered, discover.BaselineOptions{CheckMissing: failOnMissing})
+	for _, image := range report.Unknown {
+		logger.Error("discovered an image that is not part of the baseline", "image", image.Image)
+	}
+	for _, image := range report.Missing {
+		logger.Error("did not discover an image that is part of the baseline", "image", image)
+	}
+
+	if err := discover.WriteBaselineReport(reportOut, report); err != nil {
+		logger.Error("failed to write baseline report", "errMsg", err)
+		return err
+	}
+
+	if !report.Passed {
+		// The failures have already been reported, so only the exit code
+		// needs to reflect them.
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return apperrors.ErrBaselineCheckFailed
+	}
+
+	logger.Info("all discovered images are part of the baseline")
+	return nil
+}
+
+// checkDiscoveredManifest checks the manifest produced by a discovery run
+// against the baseline configured in cfg.
+func checkDiscoveredManifest(cmd *cobra.Command, logger *slog.Logger, cfg *config, discovered discovery.Manifest) error {
+	reportOut, closeReport, err := openReport(cmd, cfg.BaselineReport)
+	if err != nil {
+		logger.Error("failed to create baseline report", "path", cfg.BaselineReport, "errMsg", err)
+		return err
+	}
+	defer closeReport()
+
+	return checkBaseline(cmd, logger, cfg.BaselinePath, discovered, cfg.FailOnMissing, reportOut)
+}
+
+// openReport returns the writer a report should be written to: the file at
+// path, or stderr if path is empty. The returned func closes the file.
+func openReport(cmd *cobra.Command, path string) (io.Writer, func(), error) {
+	if path == "" {
+		return cmd.ErrOrStderr(), func() {}, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, func() { f.Close() }, nil
+}
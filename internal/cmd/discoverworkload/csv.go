@@ -0,0 +1,64 @@
+package discoverworkload
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/discover"
+	"github.com/opdev/discover-workload/internal/olm"
+)
+
+// checkClusterServiceVersions compares discovered with the images declared by
+// the ClusterServiceVersions found in namespaces, and writes the report to
+// the destination configured in cfg. Mismatches are reported, but do not
+// fail the command.
+func checkClusterServiceVersions(
+	cmd *cobra.Command,
+	logger *slog.Logger,
+	cfg *config,
+	namespaces []string,
+	discovered discovery.Manifest,
+) error {
+	client, err := discover.InitializeDynamicClient(cfg.KubeconfigPath)
+	if err != nil {
+		logger.Error("unable to initialize a dynamic kubernetes client", "errMsg", err)
+		return err
+	}
+
+	csvs, err := olm.FindClusterServiceVersions(cmd.Context(), client, namespaces)
+	if err != nil {
+		logger.Error("failed to find ClusterServiceVersions", "errMsg", err)
+		return err
+	}
+	if len(csvs) == 0 {
+		logger.Warn("no ClusterServiceVersions were found in the watched namespaces")
+	}
+
+	report := olm.Compare(discovered, csvs)
+	for _, image := range report.Undeclared {
+		logger.Warn("image is running but is not declared by the ClusterServiceVersion", "image", image)
+	}
+	for _, image := range report.Unobserved {
+		logger.Warn("image is declared by the ClusterServiceVersion but was never observed running", "image", image)
+	}
+
+	reportOut, closeReport, err := openReport(cmd, cfg.CSVReport)
+	if err != nil {
+		logger.Error("failed to create ClusterServiceVersion report", "path", cfg.CSVReport, "errMsg", err)
+		return err
+	}
+	defer closeReport()
+
+	reportJSON, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		logger.Error("failed to write ClusterServiceVersion report", "errMsg", err)
+		return err
+	}
+
+	_, err = fmt.Fprintln(reportOut, string(reportJSON))
+	return err
+}
@@ -0,0 +1,67 @@
+package discoverworkload
+
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/discover"
+	"github.com/opdev/discover-workload/internal/olm"
+)
+
+// findCustomResourceImages returns the images referenced by the custom
+// resources in namespaces, of the resources configured in cfg and, if
+// requested, of the CRDs owned by the ClusterServiceVersions in namespaces.
+func findCustomResourceImages(
+	cmd *cobra.Command,
+	logger *slog.Logger,
+	cfg *config,
+	namespaces []string,
+) (discovery.Manifest, error) {
+	gvrs := make([]schema.GroupVersionResource, 0, len(cfg.CustomResources))
+	for _, resource := range cfg.CustomResources {
+		gvr, err := discover.ParseGroupVersionResource(resource)
+		if err != nil {
+			logger.Error("failed to parse custom resource", "resourceValue", resource)
+			return discovery.Manifest{}, err
+		}
+		gvrs = append(gvrs, gvr)
+	}
+
+	client, err := discover.InitializeDynamicClient(cfg.KubeconfigPath)
+	if err != nil {
+		logger.Error("unable to initialize a dynamic kubernetes client", "errMsg", err)
+		return discovery.Manifest{}, err
+	}
+
+	resources, err := discover.InitializeDiscoveryClient(cfg.KubeconfigPath)
+	if err != nil {
+		logger.Error("unable to initialize a kubernetes discovery client", "errMsg", err)
+		return discovery.Manifest{}, err
+	}
+
+	if cfg.CSVOwnedResources {
+		csvs, err := olm.FindClusterServiceVersions(cmd.Context(), client, namespaces)
+		if err != nil {
+			logger.Error("failed to find ClusterServiceVersions", "errMsg", err)
+			return discovery.Manifest{}, err
+		}
+		for _, gvr := range olm.OwnedResources(csvs) {
+			if !slices.Contains(gvrs, gvr) {
+				gvrs = append(gvrs, gvr)
+			}
+		}
+	}
+
+	logger.Info("searching custom resources for images", "resources", gvrs)
+	m, err := discover.FindCustomResourceImages(cmd.Context(), logger, client, resources, gvrs, namespaces)
+	if err != nil {
+		logger.Error("failed to search custom resources for images", "errMsg", err)
+		return discovery.Manifest{}, err
+	}
+
+	return m, nil
+}
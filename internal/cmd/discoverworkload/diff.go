@@ -0,0 +1,80 @@
+package discoverworkload
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/opdev/discover-workload/internal/apperrors"
+	"github.com/opdev/discover-workload/internal/discover"
+)
+
+const (
+	diffShortDesc = "Compare two manifests produced by discovery runs."
+	diffLongDesc  = diffShortDesc + `
+
+Reports images that were added, removed, or changed (the same repository with
+a different tag or digest), and containers that moved between images. Exits
+with code 2 if the manifests differ.`
+)
+
+type diffConfig struct {
+	Output string
+}
+
+func newDiffCommand(rootCfg *config) *cobra.Command {
+	cfg := &diffConfig{}
+
+	c := &cobra.Command{
+		Use:   "diff [flags] old-manifest.json new-manifest.json",
+		Short: diffShortDesc,
+		Long:  diffLongDesc,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := newLogger(rootCfg.LogLevel, os.Stderr)
+			if err != nil {
+				return fmt.Errorf("failed to build a logger: %w", err)
+			}
+
+			if !slices.Contains(discover.DiffFormats, cfg.Output) {
+				logger.Error("unsupported output format", "outputValue", cfg.Output)
+				return fmt.Errorf("unsupported output format %q, must be one of %v", cfg.Output, discover.DiffFormats)
+			}
+
+			oldManifest, err := discover.ReadManifestFile(args[0])
+			if err != nil {
+				logger.Error("failed to read manifest", "path", args[0], "errMsg", err)
+				return err
+			}
+
+			newManifest, err := discover.ReadManifestFile(args[1])
+			if err != nil {
+				logger.Error("failed to read manifest", "path", args[1], "errMsg", err)
+				return err
+			}
+
+			diff := discover.DiffManifests(oldManifest, newManifest)
+			if err := discover.WriteManifestDiff(cmd.OutOrStdout(), diff, cfg.Output); err != nil {
+				logger.Error("failed to write manifest differences", "errMsg", err)
+				return err
+			}
+
+			if diff.HasDifferences() {
+				// The differences have already been reported, so only the exit
+				// code needs to reflect them.
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return apperrors.ErrDifferencesFound
+			}
+
+			return nil
+		},
+	}
+
+	flags := c.Flags()
+	flags.StringVarP(&cfg.Output, "output", "o", discover.DiffFormatText, fmt.Sprintf("The format of the reported differences. One of %v.", discover.DiffFormats))
+
+	return c
+}
@@ -9,15 +9,21 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"regexp"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/opdev/discover-workload/discovery"
 	"github.com/opdev/discover-workload/internal/discover"
+	"github.com/opdev/discover-workload/internal/helm"
+	"github.com/opdev/discover-workload/internal/openshift"
+	"github.com/opdev/discover-workload/internal/registry"
 	"github.com/opdev/discover-workload/internal/version"
 )
 
@@ -30,13 +36,36 @@ exactly what images are being used by the deployed workloads.`
 )
 
 type config struct {
+	processingConfig
+
 	Timeout time.Duration
 	// LogLevel becomes a slog.Level, so it must be one of the predefined levels
 	LogLevel       string
 	KubeconfigPath string
 	LabelSelector  string
 	FieldSelector  string
-	CompactOutput  bool
+	BaselinePath   string
+	BaselineReport string
+	FailOnMissing  bool
+	Filenames      []string
+	MustGatherPath string
+	RecordPath     string
+	CheckCSV       bool
+	CSVReport      string
+	HelmChart      string
+	HelmValues     []string
+	HelmRelease    string
+
+	CustomResources   []string
+	CSVOwnedResources bool
+
+	InspectRegistry  bool
+	RegistryAuthFile string
+	PullSecrets      bool
+	RegistryInsecure []string
+	NodePlatforms    bool
+	ImageStreams     bool
+	MirrorSets       bool
 }
 
 func NewCommand(ctx context.Context) *cobra.Command {
@@ -47,17 +76,38 @@ func NewCommand(ctx context.Context) *cobra.Command {
 		Short:   shortDesc,
 		Long:    longDesc,
 		Version: fmt.Sprintf("%s (%s)", version.Version, version.Commit),
-		Args:    cobra.MinimumNArgs(1),
+		Args:    cobra.ArbitraryArgs,
 		RunE: func(cmd *cobra.Command, namespaces []string) error {
 			logger, err := newLogger(cfg.LogLevel, os.Stderr)
 			if err != nil {
 				return fmt.Errorf("failed to build a logger: %w", err)
 			}
 
-			k8sclient, err := discover.InitializeKubernetesClient(cfg.KubeconfigPath)
-			if err != nil {
-				logger.Error("unable to initialize a kubernetes client", "errMsg", err)
-				return err
+			offline := len(cfg.Filenames) > 0 || cfg.MustGatherPath != "" || cfg.HelmChart != ""
+			if len(namespaces) == 0 && !offline {
+				return errors.New("at least one namespace is required when discovering workloads in a cluster")
+			}
+			searchCustomResources := len(cfg.CustomResources) > 0 || cfg.CSVOwnedResources
+			if searchCustomResources && offline {
+				return errors.New("custom resources can only be searched for images in a cluster")
+			}
+			if cfg.PullSecrets && offline {
+				return errors.New("pull secrets can only be read from a cluster")
+			}
+			if cfg.NodePlatforms && offline {
+				return errors.New("node platforms can only be resolved in a cluster")
+			}
+			if cfg.ImageStreams && offline {
+				return errors.New("ImageStreams can only be resolved in a cluster")
+			}
+			if cfg.MirrorSets && offline {
+				return errors.New("mirror sets can only be read from a cluster; use --mirror-set-file instead")
+			}
+			if cfg.RecordPath != "" && offline {
+				return errors.New("watch events can only be recorded in a cluster")
+			}
+			if cfg.CheckCSV && len(namespaces) == 0 {
+				return errors.New("at least one namespace is required to find ClusterServiceVersions")
 			}
 
 			_, err = metav1.ParseToLabelSelector(cfg.LabelSelector)
@@ -72,40 +122,130 @@ func NewCommand(ctx context.Context) *cobra.Command {
 				return err
 			}
 
-			ctx, cancel := context.WithTimeout(cmd.Context(), cfg.Timeout)
+			opts, err := newProcessorOptions(logger, &cfg.processingConfig)
+			if err != nil {
+				return err
+			}
 
-			go discover.StartNotifier(ctx, logger, 15*time.Second, 30*time.Second)
+			// The discovered manifest is kept for the checks run after it is
+			// written.
+			var discovered discovery.Manifest
+			var registryClient *registry.Client
+			writer := opts.Writer
+			opts.Writer = func(out io.Writer, m discovery.Manifest) error {
+				if registryClient != nil {
+					// The watch context may have expired by now.
+					m = registryClient.Enrich(cmd.Context(), m, logger)
+					for _, image := range m.DiscoveredImages {
+						if missing := discover.MissingPlatforms(image); len(missing) > 0 {
+							logger.Warn("image does not support every platform it ran on", "image", image.Image, "missing", missing)
+						}
+					}
+				}
+				discovered = m
+				return writer(out, m)
+			}
+
+			var k8sclient *kubernetes.Clientset
+			if !offline {
+				k8sclient, err = discover.InitializeKubernetesClient(cfg.KubeconfigPath)
+				if err != nil {
+					logger.Error("unable to initialize a kubernetes client", "errMsg", err)
+					return err
+				}
+			}
 
-			logger.Info("starting to watch for workloads", "duration", cfg.Timeout)
+			if cfg.InspectRegistry {
+				registryClient, err = newRegistryClient(cmd, logger, cfg, k8sclient, namespaces)
+				if err != nil {
+					return err
+				}
+			}
 
-			go gracefulShutdown(cancel)
+			var customResourceImages discovery.Manifest
+			if searchCustomResources {
+				customResourceImages, err = findCustomResourceImages(cmd, logger, cfg, namespaces)
+				if err != nil {
+					return err
+				}
+			}
 
 			var buffer bytes.Buffer
 
-			opts := discover.NewManifestJSONProcessorFnOptions{
-				CompactOutput: cfg.CompactOutput,
-			}
-			err = discover.WatchForWorkloads(
-				ctx,
-				logger,
-				namespaces,
-				metav1.ListOptions{
-					LabelSelector: cfg.LabelSelector,
-					FieldSelector: cfg.FieldSelector,
-				},
-				k8sclient,
-				discover.NewManifestJSONProcessorFn(&buffer, opts),
-			)
-			if err != nil {
-				switch {
-				case errors.Is(err, context.DeadlineExceeded):
-					cancel()
-					logger.Info("completed execution because the max watch duration was reached.")
-					return nil
-				default:
-					cancel()
+			opts.Include = customResourceImages
+			if cfg.Attribution && !offline {
+				// Owners can only be looked up in a cluster.
+				opts.Components = discover.NewComponentResolver(k8sclient, logger)
+			}
+			if cfg.NodePlatforms {
+				opts.Platforms = discover.NewPlatformResolver(k8sclient, logger)
+			}
+			if cfg.ImageStreams {
+				dynamicClient, err := discover.InitializeDynamicClient(cfg.KubeconfigPath)
+				if err != nil {
+					logger.Error("unable to initialize a dynamic kubernetes client", "errMsg", err)
+					return err
+				}
+				opts.ImageStreams = openshift.NewImageStreamResolver(dynamicClient, logger).Resolve
+			}
+			if cfg.MirrorSets {
+				mirrorRules, err := findMirrorRules(cmd, logger, cfg)
+				if err != nil {
+					return err
+				}
+				opts.Mirrors = mirrorRules.Resolve
+			}
+			processorFn := discover.NewManifestJSONProcessorFn(&buffer, opts)
+			listOptions := metav1.ListOptions{
+				LabelSelector: cfg.LabelSelector,
+				FieldSelector: cfg.FieldSelector,
+			}
+
+			if offline {
+				err = discoverOffline(cmd, logger, cfg, namespaces, listOptions, processorFn)
+				if err != nil {
 					return err
 				}
+			} else {
+				var journal *discover.Journal
+				if cfg.RecordPath != "" {
+					journalFile, err := os.Create(cfg.RecordPath)
+					if err != nil {
+						logger.Error("failed to create the event journal", "path", cfg.RecordPath, "errMsg", err)
+						return err
+					}
+					defer journalFile.Close()
+					journal = discover.NewJournal(journalFile)
+					logger.Info("recording watch events", "path", cfg.RecordPath)
+				}
+
+				ctx, cancel := context.WithTimeout(cmd.Context(), cfg.Timeout)
+
+				go discover.StartNotifier(ctx, logger, 15*time.Second, 30*time.Second)
+
+				logger.Info("starting to watch for workloads", "duration", cfg.Timeout)
+
+				go gracefulShutdown(cancel)
+
+				err = discover.WatchForWorkloads(
+					ctx,
+					logger,
+					namespaces,
+					listOptions,
+					k8sclient,
+					processorFn,
+					journal,
+				)
+				cancel()
+				if err != nil {
+					switch {
+					case errors.Is(err, context.DeadlineExceeded):
+						logger.Info("completed execution because the max watch duration was reached.")
+						return nil
+					default:
+						return err
+					}
+				}
 			}
 
 			_, err = buffer.WriteTo(cmd.OutOrStdout())
@@ -114,19 +254,61 @@ func NewCommand(ctx context.Context) *cobra.Command {
 				return err
 			}
 
-			cancel()
+			if cfg.BaselinePath == "" && !cfg.CheckCSV {
+				return nil
+			}
+
+			if cfg.CheckCSV {
+				err = checkClusterServiceVersions(cmd, logger, cfg, namespaces, discovered)
+				if err != nil {
+					return err
+				}
+			}
+
+			if cfg.BaselinePath != "" {
+				return checkDiscoveredManifest(cmd, logger, cfg, discovered)
+			}
+
 			return nil
 		},
 	}
 	c.SetContext(ctx)
 
+	c.PersistentFlags().StringVarP(&cfg.LogLevel, "log-level", "v", "INFO", "How verbose you want this tool to be")
+
 	flags := c.Flags()
-	flags.StringVarP(&cfg.LogLevel, "log-level", "v", "INFO", "How verbose you want this tool to be")
 	flags.DurationVarP(&cfg.Timeout, "duration", "d", 1*time.Minute, "How long this tool should continue to watch for workloads.")
 	flags.StringVarP(&cfg.KubeconfigPath, "kubeconfig", "k", clientcmd.RecommendedHomeFile, "The kubeconfig to use for cluster access.")
 	flags.StringVarP(&cfg.LabelSelector, "selector", "l", "", "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2). Matching objects must satisfy all of the specified label constraints.")
 	flags.StringVar(&cfg.FieldSelector, "field-selector", "", "Selector (field query) to filter on, supports '=', '==', and '!='.(e.g. --field-selector key1=value1,key2=value2). The server only supports a limited number of field queries per type.")
-	flags.BoolVarP(&cfg.CompactOutput, "compact", "c", false, "Print JSON in compact format instead of pretty-printed output")
+	addProcessingFlags(flags, &cfg.processingConfig)
+	flags.StringSliceVarP(&cfg.Filenames, "filename", "f", nil, "Discover workloads from YAML or JSON files, directories, or '-' for stdin, instead of a cluster. Namespaces are optional and filter the workloads that are read.")
+	flags.StringVar(&cfg.MustGatherPath, "must-gather", "", "Discover workloads from a must-gather or oc adm inspect directory or .tar.gz archive, instead of a cluster. Namespaces are optional and filter the workloads that are read.")
+	flags.StringVar(&cfg.HelmChart, "helm-chart", "", "Discover workloads by rendering a Helm chart directory or .tgz archive locally, instead of a cluster. The first namespace, if any, is the release namespace.")
+	flags.StringSliceVar(&cfg.HelmValues, "helm-values", nil, "Values files used to render --helm-chart.")
+	flags.StringVar(&cfg.HelmRelease, "helm-release", helm.DefaultReleaseName, "The release name used to render --helm-chart.")
+	flags.BoolVar(&cfg.CheckCSV, "check-csv", false, "Compare discovered images with the relatedImages and deployments of the ClusterServiceVersions in the watched namespaces.")
+	flags.StringVar(&cfg.CSVReport, "csv-report", "", "Where to write the JSON ClusterServiceVersion report. Defaults to stderr.")
+	flags.StringSliceVar(&cfg.CustomResources, "custom-resource", nil, "Search the custom resources of this resource, in the resource.version.group form, for image references. May be repeated.")
+	flags.BoolVar(&cfg.CSVOwnedResources, "csv-owned-resources", false, "Search the custom resources of every CRD owned by the ClusterServiceVersions in the watched namespaces for image references.")
+	flags.BoolVar(&cfg.NodePlatforms, "node-platforms", false, "Record the os and architecture of the node each container ran on, and the platforms each image must support.")
+	flags.BoolVar(&cfg.ImageStreams, "resolve-image-streams", false, "Resolve images in the OpenShift internal registry to their ImageStream, and record the external image it was imported from.")
+	flags.BoolVar(&cfg.MirrorSets, "mirror-sets", false, "Record the canonical source and mirrors of each image, from the cluster's ImageDigestMirrorSets, ImageTagMirrorSets and ImageContentSourcePolicies.")
+	flags.BoolVar(&cfg.InspectRegistry, "inspect-registry", false, "Resolve the digest, platforms and labels of each discovered image in its registry.")
+	flags.StringVar(&cfg.RegistryAuthFile, "registry-auth-file", "", "A docker or podman auth file with credentials for --inspect-registry.")
+	flags.BoolVar(&cfg.PullSecrets, "pull-secrets", false, "Use the image pull secrets referenced by the pods and service accounts in the watched namespaces as credentials for --inspect-registry.")
+	flags.StringSliceVar(&cfg.RegistryInsecure, "registry-insecure", nil, "Registries, e.g. localhost:5000, which --inspect-registry reaches over plain HTTP rather than HTTPS.")
+	flags.StringVar(&cfg.RecordPath, "record", "", "Record every watch event to this file as newline-delimited JSON, for use with the replay subcommand.")
+	flags.StringVar(&cfg.BaselinePath, "baseline", "", "A manifest of allowed images. Discovery fails if any other image is found.")
+	flags.StringVar(&cfg.BaselineReport, "baseline-report", "", "Where to write the JSON baseline report. Defaults to stderr.")
+	flags.BoolVar(&cfg.FailOnMissing, "fail-on-missing", false, "Also fail if images in the baseline were not discovered. Requires --baseline.")
+
+	c.AddCommand(newDiffCommand(cfg))
+	c.AddCommand(newMergeCommand(cfg))
+	c.AddCommand(newCheckCommand(cfg))
+	c.AddCommand(newReplayCommand(cfg))
+	c.AddCommand(newBundleCommand(cfg))
+	c.AddCommand(newMirrorCommand(cfg))
 
 	return c
 }
@@ -157,9 +339,72 @@ func newLogger(level string, out io.Writer) (*slog.Logger, error) {
 	return logger, nil
 }
 
+// parseEnvImagePattern compiles the environment variable image pattern. A nil
+// pattern, which disables collecting referenced images, is returned for an
+// empty value.
+func parseEnvImagePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile(pattern)
+}
+
 func gracefulShutdown(cancel context.CancelFunc) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	cancel()
 }
+
+// discoverOffline reads workloads from the files, must-gather, and Helm chart
+// configured in cfg, filters them by namespace and by the selectors in
+// listOptions, and sends them to processorFn.
+func discoverOffline(
+	cmd *cobra.Command,
+	logger *slog.Logger,
+	cfg *config,
+	namespaces []string,
+	listOptions metav1.ListOptions,
+	processorFn discover.ProcessingFunction,
+) error {
+	pods, err := discover.ReadPodsFromPaths(cfg.Filenames, cmd.InOrStdin(), logger)
+	if err != nil {
+		logger.Error("failed to read workloads", "errMsg", err)
+		return err
+	}
+
+	if cfg.MustGatherPath != "" {
+		found, err := discover.ReadPodsFromMustGather(cfg.MustGatherPath, logger)
+		if err != nil {
+			logger.Error("failed to read workloads from must-gather", "path", cfg.MustGatherPath, "errMsg", err)
+			return err
+		}
+		pods = append(pods, found...)
+	}
+
+	if cfg.HelmChart != "" {
+		renderOpts := helm.RenderOptions{
+			ReleaseName: cfg.HelmRelease,
+			ValuesFiles: cfg.HelmValues,
+		}
+		if len(namespaces) > 0 {
+			renderOpts.Namespace = namespaces[0]
+		}
+
+		found, err := helm.ReadPodsFromChart(cmd.Context(), cfg.HelmChart, renderOpts, logger)
+		if err != nil {
+			logger.Error("failed to read workloads from the Helm chart", "path", cfg.HelmChart, "errMsg", err)
+			return err
+		}
+		pods = append(pods, found...)
+	}
+
+	pods, err = discover.FilterPods(pods, namespaces, listOptions)
+	if err != nil {
+		logger.Error("failed to filter workloads", "errMsg", err)
+		return err
+	}
+
+	return discover.ProcessPods(cmd.Context(), logger, pods, processorFn)
+}
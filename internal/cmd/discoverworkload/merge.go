@@ -0,0 +1,87 @@
+package discoverworkload
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/discover"
+)
+
+const (
+	mergeShortDesc = "Combine manifests from multiple discovery runs or clusters."
+	mergeLongDesc  = mergeShortDesc + `
+
+Each argument is a manifest file, optionally prefixed with a source name in the
+form name=path. Containers are attributed to the source they were found in,
+which defaults to the file name when no source name is given. Containers that
+already record their sources, e.g. from a previous merge, keep them.`
+)
+
+type mergeConfig struct {
+	CompactOutput bool
+	Sort          string
+}
+
+func newMergeCommand(rootCfg *config) *cobra.Command {
+	cfg := &mergeConfig{}
+
+	c := &cobra.Command{
+		Use:   "merge [flags] [name=]manifest.json [name=]manifest.json...",
+		Short: mergeShortDesc,
+		Long:  mergeLongDesc,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := newLogger(rootCfg.LogLevel, os.Stderr)
+			if err != nil {
+				return fmt.Errorf("failed to build a logger: %w", err)
+			}
+
+			sortOrder, err := discover.ParseSortOrder(cfg.Sort)
+			if err != nil {
+				logger.Error("failed to parse sort order", "sortValue", cfg.Sort)
+				return err
+			}
+
+			manifests := make([]discovery.Manifest, 0, len(args))
+			for _, arg := range args {
+				source, path := parseMergeSource(arg)
+				m, err := discover.ReadManifestFile(path)
+				if err != nil {
+					logger.Error("failed to read manifest", "path", path, "errMsg", err)
+					return err
+				}
+				logger.Debug("read manifest", "path", path, "source", source, "images", len(m.DiscoveredImages))
+				manifests = append(manifests, discover.WithSource(m, source))
+			}
+
+			merged := discover.SortManifest(discover.MergeManifests(manifests...), sortOrder)
+			if err := discover.WriteManifest(cmd.OutOrStdout(), merged, cfg.CompactOutput); err != nil {
+				logger.Error("failed to write merged manifest", "errMsg", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	flags := c.Flags()
+	flags.BoolVarP(&cfg.CompactOutput, "compact", "c", false, "Print JSON in compact format instead of pretty-printed output")
+	flags.StringVar(&cfg.Sort, "sort", discover.SortByImage, fmt.Sprintf("How to order the manifest before it is printed. One of %v.", discover.SortOrders))
+
+	return c
+}
+
+// parseMergeSource splits a merge argument into its source name and path. The
+// file name is used as the source name if none was provided.
+func parseMergeSource(arg string) (source, path string) {
+	if name, p, found := strings.Cut(arg, "="); found && name != "" {
+		return name, p
+	}
+
+	return filepath.Base(arg), arg
+}
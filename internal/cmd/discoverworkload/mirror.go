@@ -0,0 +1,76 @@
+package discoverworkload
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/discover"
+)
+
+const (
+	mirrorShortDesc = "Plan the mirroring of the images in manifests."
+	mirrorLongDesc  = mirrorShortDesc + `
+
+Reads one or more manifests, and writes the configuration of a mirroring tool
+which copies every image they contain into a mirror registry. Images are
+mirrored from their canonical source or ImageStream source when one was
+recorded, by digest when one is known.`
+)
+
+type mirrorConfig struct {
+	Output             string
+	MirrorRegistry     string
+	MirrorRewriteRules string
+	TagMirrors         bool
+}
+
+func newMirrorCommand(rootCfg *config) *cobra.Command {
+	cfg := &mirrorConfig{}
+
+	c := &cobra.Command{
+		Use:   "mirror [flags] manifest.json [manifest.json...]",
+		Short: mirrorShortDesc,
+		Long:  mirrorLongDesc,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := newLogger(rootCfg.LogLevel, os.Stderr)
+			if err != nil {
+				return fmt.Errorf("failed to build a logger: %w", err)
+			}
+
+			writer, err := newMirrorWriter(cfg.Output, cfg.MirrorRegistry, cfg.MirrorRewriteRules, cfg.TagMirrors)
+			if err != nil {
+				logger.Error("failed to configure the output format", "outputValue", cfg.Output, "errMsg", err)
+				return err
+			}
+
+			manifests := make([]discovery.Manifest, 0, len(args))
+			for _, path := range args {
+				m, err := discover.ReadManifestFile(path)
+				if err != nil {
+					logger.Error("failed to read manifest", "path", path, "errMsg", err)
+					return err
+				}
+				manifests = append(manifests, m)
+			}
+
+			if err := writer(cmd.OutOrStdout(), discover.MergeManifests(manifests...)); err != nil {
+				logger.Error("failed to write the mirroring plan", "errMsg", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	flags := c.Flags()
+	flags.StringVarP(&cfg.Output, "output", "o", outputOCMirror, fmt.Sprintf("The format of the mirroring plan. One of %v.", mirrorFormats))
+	flags.StringVar(&cfg.MirrorRegistry, "mirror-registry", "", "The registry, and optional path, to mirror images to. Required by the oc-image-mirror and mirror-sets formats, and mentioned in a comment by the others, as those tools take it on their command line.")
+	flags.StringVar(&cfg.MirrorRewriteRules, "mirror-rewrite-rules", "", "A YAML file of rules placing repositories at other paths in the mirror registry, for the oc-image-mirror and mirror-sets formats. oc-mirror and skopeo choose the path of each repository themselves, so the rules cannot apply to their formats.")
+	flags.BoolVar(&cfg.TagMirrors, "tag-mirrors", false, "Also write an ImageTagMirrorSet for the images referenced by tag, with the mirror-sets format.")
+
+	return c
+}
@@ -0,0 +1,37 @@
+package discoverworkload
+
+import (
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/opdev/discover-workload/internal/discover"
+	"github.com/opdev/discover-workload/internal/openshift"
+)
+
+// findMirrorRules returns the rules of the mirror set files configured in cfg
+// and, if requested, of the mirror sets in the cluster.
+func findMirrorRules(cmd *cobra.Command, logger *slog.Logger, cfg *config) (openshift.MirrorRules, error) {
+	rules, err := openshift.ReadMirrorRules(cfg.MirrorSetFiles)
+	if err != nil {
+		logger.Error("failed to read mirror sets", "paths", cfg.MirrorSetFiles, "errMsg", err)
+		return nil, err
+	}
+
+	if cfg.MirrorSets {
+		client, err := discover.InitializeDynamicClient(cfg.KubeconfigPath)
+		if err != nil {
+			logger.Error("unable to initialize a dynamic kubernetes client", "errMsg", err)
+			return nil, err
+		}
+
+		found, err := openshift.FindMirrorRules(cmd.Context(), client, logger)
+		if err != nil {
+			logger.Error("failed to find mirror sets", "errMsg", err)
+			return nil, err
+		}
+		rules = append(rules, found...)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,139 @@
+package discoverworkload
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/cyclonedx"
+	"github.com/opdev/discover-workload/internal/discover"
+	"github.com/opdev/discover-workload/internal/mirror"
+	"github.com/opdev/discover-workload/internal/olm"
+	"github.com/opdev/discover-workload/internal/version"
+)
+
+const (
+	outputJSON               = "json"
+	outputRelatedImages      = "related-images"
+	outputRelatedImagesPatch = "related-images-patch"
+	outputOCMirror           = "oc-mirror"
+	outputOCImageMirror      = "oc-image-mirror"
+	outputSkopeoSync         = "skopeo-sync"
+	outputMirrorSets         = "mirror-sets"
+	outputCycloneDXJSON      = "cyclonedx-json"
+	outputCycloneDXXML       = "cyclonedx-xml"
+
+	// defaultWorkloadName names the workload described by a CycloneDX BOM
+	// when no --source-name is given.
+	defaultWorkloadName = "discovered-workload"
+)
+
+// outputFormats lists the formats in which a discovered manifest can be
+// written.
+var outputFormats = slices.Concat(
+	[]string{outputJSON, outputRelatedImages, outputRelatedImagesPatch},
+	mirrorFormats,
+	[]string{outputCycloneDXJSON, outputCycloneDXXML},
+)
+
+// mirrorFormats lists the formats in which the images of a manifest can be
+// planned for mirroring.
+var mirrorFormats = []string{outputOCMirror, outputOCImageMirror, outputSkopeoSync, outputMirrorSets}
+
+// newManifestWriter returns the ManifestWriter for the output format
+// configured in cfg.
+func newManifestWriter(cfg *processingConfig) (discover.ManifestWriter, error) {
+	if !slices.Contains(outputFormats, cfg.Output) {
+		return nil, fmt.Errorf("unsupported output format %q, must be one of %v", cfg.Output, outputFormats)
+	}
+	if cfg.Output == outputRelatedImagesPatch && cfg.PatchCSVPath == "" {
+		return nil, errors.New("--patch-csv is required for the related-images-patch output format")
+	}
+
+	switch cfg.Output {
+	case outputRelatedImages:
+		return func(out io.Writer, m discovery.Manifest) error {
+			return olm.WriteRelatedImages(out, olm.RelatedImagesFromManifest(m))
+		}, nil
+	case outputRelatedImagesPatch:
+		csv, err := olm.ReadClusterServiceVersionFile(cfg.PatchCSVPath)
+		if err != nil {
+			return nil, err
+		}
+		return func(out io.Writer, m discovery.Manifest) error {
+			return olm.WriteRelatedImagesPatch(out, olm.RelatedImagesPatch(csv, olm.RelatedImagesFromManifest(m)))
+		}, nil
+	case outputOCMirror, outputOCImageMirror, outputSkopeoSync, outputMirrorSets:
+		return newMirrorWriter(cfg.Output, cfg.MirrorRegistry, cfg.MirrorRewriteRules, cfg.TagMirrors)
+	case outputCycloneDXJSON, outputCycloneDXXML:
+		write := cyclonedx.WriteJSON
+		if cfg.Output == outputCycloneDXXML {
+			write = cyclonedx.WriteXML
+		}
+		return func(out io.Writer, m discovery.Manifest) error {
+			return write(out, cyclonedx.FromManifest(m, cyclonedx.Options{
+				Name:        cmp.Or(cfg.SourceName, defaultWorkloadName),
+				ToolVersion: version.Version,
+				Timestamp:   time.Now(),
+			}))
+		}, nil
+	default:
+		return discover.NewJSONManifestWriter(cfg.CompactOutput), nil
+	}
+}
+
+// newMirrorWriter returns the ManifestWriter which plans the mirroring of a
+// manifest's images into registry, in one of mirrorFormats. For the mirror-sets
+// format, tagMirrors adds an ImageTagMirrorSet for images referenced by tag.
+func newMirrorWriter(format, registry, rewriteRulesPath string, tagMirrors bool) (discover.ManifestWriter, error) {
+	targeted := format == outputOCImageMirror || format == outputMirrorSets
+	if targeted && registry == "" {
+		return nil, fmt.Errorf("--mirror-registry is required for the %s output format", format)
+	}
+	if rewriteRulesPath != "" && !targeted {
+		// oc-mirror and skopeo choose the path of each repository.
+		return nil, errors.New("--mirror-rewrite-rules is only supported by the oc-image-mirror and mirror-sets output formats, as oc-mirror and skopeo choose the path of each repository themselves")
+	}
+
+	plan := mirror.Plan{Target: registry}
+	if rewriteRulesPath != "" {
+		rules, err := mirror.ReadRewriteRulesFile(rewriteRulesPath)
+		if err != nil {
+			return nil, err
+		}
+		plan.Rules = rules
+	}
+
+	switch format {
+	case outputOCMirror:
+		return func(out io.Writer, m discovery.Manifest) error {
+			return mirror.WriteImageSetConfiguration(out, mirror.SourceImages(m), registry)
+		}, nil
+	case outputOCImageMirror:
+		return func(out io.Writer, m discovery.Manifest) error {
+			mappings, err := plan.Mappings(m)
+			if err != nil {
+				return err
+			}
+			return mirror.WriteMapping(out, mappings)
+		}, nil
+	case outputSkopeoSync:
+		return func(out io.Writer, m discovery.Manifest) error {
+			return mirror.WriteSkopeoSync(out, mirror.SourceImages(m), registry)
+		}, nil
+	case outputMirrorSets:
+		return func(out io.Writer, m discovery.Manifest) error {
+			rules, err := plan.MirrorRules(m, tagMirrors)
+			if err != nil {
+				return err
+			}
+			return mirror.WriteMirrorSets(out, rules, mirror.MirrorSetName)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mirroring format %q, must be one of %v", format, mirrorFormats)
+	}
+}
@@ -0,0 +1,140 @@
+package discoverworkload
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/spf13/pflag"
+
+	"github.com/opdev/discover-workload/internal/discover"
+	"github.com/opdev/discover-workload/internal/openshift"
+)
+
+// processingConfig configures how discovered pods are processed into a
+// manifest, and how it is written. It is shared by discovery runs and the
+// replay of their journals, so that a replay produces the same output.
+type processingConfig struct {
+	CompactOutput bool
+	Sort          string
+	SourceName    string
+	EnvImageRegex string
+
+	Output             string
+	PatchCSVPath       string
+	MirrorRegistry     string
+	MirrorRewriteRules string
+	TagMirrors         bool
+
+	ContainerTypes    []string
+	ExcludeReferences bool
+	InjectionRules    string
+	ExcludeInjected   bool
+	RegistryRules     string
+	Categories        []string
+	Attribution       bool
+	MirrorSetFiles    []string
+}
+
+// addProcessingFlags registers the flags of cfg.
+func addProcessingFlags(flags *pflag.FlagSet, cfg *processingConfig) {
+	flags.BoolVarP(&cfg.CompactOutput, "compact", "c", false, "Print JSON in compact format instead of pretty-printed output")
+	flags.StringVar(&cfg.Sort, "sort", discover.SortByImage, fmt.Sprintf("How to order the manifest before it is printed. One of %v.", discover.SortOrders))
+	flags.StringVar(&cfg.SourceName, "source-name", "", "A name for this discovery run (e.g. the cluster name), recorded on every discovered container.")
+	flags.StringVar(&cfg.EnvImageRegex, "env-image-pattern", discover.DefaultEnvImagePattern, "Container environment variables whose names match this regular expression are recorded as referenced images. An empty value disables this.")
+	flags.StringVarP(&cfg.Output, "output", "o", outputJSON, fmt.Sprintf("The format of the discovered manifest. One of %v.", outputFormats))
+	flags.StringVar(&cfg.PatchCSVPath, "patch-csv", "", "The ClusterServiceVersion file to patch with the related-images-patch output format.")
+	flags.StringVar(&cfg.MirrorRegistry, "mirror-registry", "", "The registry, and optional path, to mirror images to with the oc-image-mirror and mirror-sets output formats. The oc-mirror and skopeo-sync formats mention it in a comment, as those tools take it on their command line.")
+	flags.StringVar(&cfg.MirrorRewriteRules, "mirror-rewrite-rules", "", "A YAML file of rules placing repositories at other paths in the mirror registry, for the oc-image-mirror and mirror-sets output formats. oc-mirror and skopeo choose the path of each repository themselves, so the rules cannot apply to their formats.")
+	flags.BoolVar(&cfg.TagMirrors, "tag-mirrors", false, "Also write an ImageTagMirrorSet for the images referenced by tag, with the mirror-sets output format.")
+	flags.StringSliceVar(&cfg.ContainerTypes, "container-type", nil, fmt.Sprintf("Only include containers of these types in the manifest. Any of %v. Referenced images are kept unless --exclude-references is set.", discover.ContainerTypes))
+	flags.BoolVar(&cfg.ExcludeReferences, "exclude-references", false, "Remove images which were only referenced, e.g. by environment variables or custom resources, rather than run by a container.")
+	flags.StringVar(&cfg.InjectionRules, "injection-rules", "", "A YAML file of rules detecting containers injected by webhooks, in addition to the built-in rules for common service meshes.")
+	flags.BoolVar(&cfg.ExcludeInjected, "exclude-injected", false, "Remove containers injected by service meshes and webhooks from the manifest.")
+	flags.StringVar(&cfg.RegistryRules, "registry-rules", "", "A YAML file of rules categorizing images by registry and repository, in addition to the built-in rules for Red Hat and OpenShift registries.")
+	flags.StringSliceVar(&cfg.Categories, "category", nil, fmt.Sprintf("Only include images of these categories in the manifest. Any of %v.", discover.ImageCategories))
+	flags.BoolVar(&cfg.Attribution, "attribution", false, "Record the OLM operator or Helm release each container belongs to, from the labels and annotations of its pod and the pod's owners.")
+	flags.StringSliceVar(&cfg.MirrorSetFiles, "mirror-set-file", nil, "Files or directories of ImageDigestMirrorSets, ImageTagMirrorSets and ImageContentSourcePolicies to record the canonical source and mirrors of each image with.")
+}
+
+// newProcessorOptions returns the options of the manifest processor, and the
+// writer of its output, configured by cfg. Options which require a cluster,
+// such as looking up the owners of pods, are left for the caller to add.
+func newProcessorOptions(logger *slog.Logger, cfg *processingConfig) (discover.NewManifestJSONProcessorFnOptions, error) {
+	opts := discover.NewManifestJSONProcessorFnOptions{
+		CompactOutput:     cfg.CompactOutput,
+		Source:            cfg.SourceName,
+		ExcludeReferences: cfg.ExcludeReferences,
+		ExcludeInjected:   cfg.ExcludeInjected,
+	}
+
+	var err error
+	opts.Sort, err = discover.ParseSortOrder(cfg.Sort)
+	if err != nil {
+		logger.Error("failed to parse sort order", "sortValue", cfg.Sort)
+		return opts, err
+	}
+
+	opts.EnvImagePattern, err = parseEnvImagePattern(cfg.EnvImageRegex)
+	if err != nil {
+		logger.Error("failed to parse environment variable image pattern", "patternValue", cfg.EnvImageRegex)
+		return opts, err
+	}
+
+	opts.ContainerTypes, err = discover.ParseContainerTypes(cfg.ContainerTypes)
+	if err != nil {
+		logger.Error("failed to parse container types", "containerTypeValue", cfg.ContainerTypes)
+		return opts, err
+	}
+
+	opts.InjectionRules = discover.DefaultInjectionRules
+	if cfg.InjectionRules != "" {
+		custom, err := discover.ReadInjectionRulesFile(cfg.InjectionRules)
+		if err != nil {
+			logger.Error("failed to read injection rules", "path", cfg.InjectionRules, "errMsg", err)
+			return opts, err
+		}
+		// Custom rules take precedence over the defaults.
+		opts.InjectionRules = slices.Concat(custom, opts.InjectionRules)
+	}
+
+	opts.Categories, err = discover.ParseImageCategories(cfg.Categories)
+	if err != nil {
+		logger.Error("failed to parse image categories", "categoryValue", cfg.Categories)
+		return opts, err
+	}
+
+	if cfg.RegistryRules != "" || len(opts.Categories) > 0 || opts.Sort == discover.SortByCategory {
+		opts.RegistryRules = discover.DefaultRegistryRules
+	}
+	if cfg.RegistryRules != "" {
+		custom, err := discover.ReadRegistryRulesFile(cfg.RegistryRules)
+		if err != nil {
+			logger.Error("failed to read registry rules", "path", cfg.RegistryRules, "errMsg", err)
+			return opts, err
+		}
+		// Custom rules take precedence over the defaults.
+		opts.RegistryRules = slices.Concat(custom, opts.RegistryRules)
+	}
+
+	if cfg.Attribution {
+		opts.Components = discover.ResolvePodComponent
+	}
+
+	if len(cfg.MirrorSetFiles) > 0 {
+		mirrorRules, err := openshift.ReadMirrorRules(cfg.MirrorSetFiles)
+		if err != nil {
+			logger.Error("failed to read mirror sets", "paths", cfg.MirrorSetFiles, "errMsg", err)
+			return opts, err
+		}
+		opts.Mirrors = mirrorRules.Resolve
+	}
+
+	opts.Writer, err = newManifestWriter(cfg)
+	if err != nil {
+		logger.Error("failed to configure the output format", "outputValue", cfg.Output, "errMsg", err)
+		return opts, err
+	}
+
+	return opts, nil
+}
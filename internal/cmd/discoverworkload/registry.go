@@ -0,0 +1,47 @@
+package discoverworkload
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opdev/discover-workload/internal/registry"
+)
+
+// registryTimeout bounds each request sent to a registry.
+const registryTimeout = 30 * time.Second
+
+// newRegistryClient returns a registry client authenticated with the auth file
+// configured in cfg and, if requested, with the image pull secrets of
+// namespaces. Credentials from the auth file take precedence.
+func newRegistryClient(
+	cmd *cobra.Command,
+	logger *slog.Logger,
+	cfg *config,
+	k8sclient kubernetes.Interface,
+	namespaces []string,
+) (*registry.Client, error) {
+	keychain := registry.Keychain{}
+	if cfg.RegistryAuthFile != "" {
+		found, err := registry.ReadAuthFile(cfg.RegistryAuthFile)
+		if err != nil {
+			logger.Error("failed to read the registry auth file", "path", cfg.RegistryAuthFile, "errMsg", err)
+			return nil, err
+		}
+		keychain.Merge(found)
+	}
+
+	if cfg.PullSecrets {
+		found, err := registry.KeychainFromSecrets(cmd.Context(), k8sclient, namespaces)
+		if err != nil {
+			logger.Error("failed to read image pull secrets", "errMsg", err)
+			return nil, err
+		}
+		keychain.Merge(found)
+	}
+
+	return registry.NewClient(&http.Client{Timeout: registryTimeout}, keychain, cfg.RegistryInsecure), nil
+}
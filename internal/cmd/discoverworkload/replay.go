@@ -0,0 +1,61 @@
+package discoverworkload
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/opdev/discover-workload/internal/discover"
+)
+
+const (
+	replayShortDesc = "Produce a manifest from watch events recorded with --record."
+	replayLongDesc  = replayShortDesc + `
+
+The pods created in the recorded journal are processed exactly as they were
+during the original discovery run, without access to the cluster. Pass the
+same flags as the original run to reproduce its output. Options which look up
+other resources in the cluster, such as the owners of pods, are not available.`
+)
+
+func newReplayCommand(rootCfg *config) *cobra.Command {
+	cfg := &processingConfig{}
+
+	c := &cobra.Command{
+		Use:   "replay [flags] journal.ndjson",
+		Short: replayShortDesc,
+		Long:  replayLongDesc,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger, err := newLogger(rootCfg.LogLevel, os.Stderr)
+			if err != nil {
+				return fmt.Errorf("failed to build a logger: %w", err)
+			}
+
+			opts, err := newProcessorOptions(logger, cfg)
+			if err != nil {
+				return err
+			}
+
+			journal, err := os.Open(args[0])
+			if err != nil {
+				logger.Error("failed to open the event journal", "path", args[0], "errMsg", err)
+				return err
+			}
+			defer journal.Close()
+
+			err = discover.ReplayJournal(cmd.Context(), logger, journal, discover.NewManifestJSONProcessorFn(cmd.OutOrStdout(), opts))
+			if err != nil {
+				logger.Error("failed to replay the event journal", "path", args[0], "errMsg", err)
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	addProcessingFlags(c.Flags(), cfg)
+
+	return c
+}
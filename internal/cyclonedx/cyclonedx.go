@@ -0,0 +1,338 @@
+// Package cyclonedx converts discovered manifests into CycloneDX 1.5 software
+// bills of materials, in which each image is a container component.
+package cyclonedx
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+const (
+	// SpecVersion is the version of the CycloneDX specification produced.
+	SpecVersion = "1.5"
+
+	bomFormat    = "CycloneDX"
+	xmlNamespace = "http://cyclonedx.org/schema/bom/1.5"
+	toolName     = "discover-workload"
+
+	// propertyPrefix namespaces the properties set on components.
+	propertyPrefix = "discover-workload:"
+
+	componentTypeApplication = "application"
+	componentTypeContainer   = "container"
+
+	// workloadRef is the bom-ref of the component describing the whole
+	// discovered workload.
+	workloadRef = "workload"
+)
+
+// hashAlgorithms maps digest algorithms to CycloneDX hash algorithms.
+var hashAlgorithms = map[string]string{
+	"sha256": "SHA-256",
+	"sha384": "SHA-384",
+	"sha512": "SHA-512",
+}
+
+// BOM is a CycloneDX bill of materials, encodable as either JSON or XML.
+type BOM struct {
+	XMLName      xml.Name     `json:"-" xml:"bom"`
+	XMLNS        string       `json:"-" xml:"xmlns,attr"`
+	BOMFormat    string       `json:"bomFormat" xml:"-"`
+	SpecVersion  string       `json:"specVersion" xml:"-"`
+	Version      int          `json:"version" xml:"version,attr"`
+	Metadata     Metadata     `json:"metadata" xml:"metadata"`
+	Components   []Component  `json:"components" xml:"components>component"`
+	Dependencies []Dependency `json:"dependencies" xml:"dependencies>dependency"`
+}
+
+// Metadata describes when and by what the BOM was produced, and what it
+// describes.
+type Metadata struct {
+	Timestamp string    `json:"timestamp" xml:"timestamp"`
+	Tools     Tools     `json:"tools" xml:"tools"`
+	Component Component `json:"component" xml:"component"`
+}
+
+// Tools lists the tools which produced the BOM.
+type Tools struct {
+	Components []Component `json:"components" xml:"components>component"`
+}
+
+// Component is a CycloneDX component, such as a container image or the
+// application deploying it.
+type Component struct {
+	Type       string     `json:"type"`
+	BOMRef     string     `json:"bom-ref,omitempty"`
+	Name       string     `json:"name"`
+	Version    string     `json:"version,omitempty"`
+	Hashes     []Hash     `json:"hashes,omitempty"`
+	PURL       string     `json:"purl,omitempty"`
+	Properties []Property `json:"properties,omitempty"`
+}
+
+// MarshalXML encodes c in the form of the XML schema, in which hashes and
+// properties are wrapped in elements that are omitted when empty.
+func (c Component) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type hashes struct {
+		Hashes []Hash `xml:"hash"`
+	}
+	type properties struct {
+		Properties []Property `xml:"property"`
+	}
+	component := struct {
+		Type       string      `xml:"type,attr"`
+		BOMRef     string      `xml:"bom-ref,attr,omitempty"`
+		Name       string      `xml:"name"`
+		Version    string      `xml:"version,omitempty"`
+		Hashes     *hashes     `xml:"hashes"`
+		PURL       string      `xml:"purl,omitempty"`
+		Properties *properties `xml:"properties"`
+	}{Type: c.Type, BOMRef: c.BOMRef, Name: c.Name, Version: c.Version, PURL: c.PURL}
+	if len(c.Hashes) > 0 {
+		component.Hashes = &hashes{Hashes: c.Hashes}
+	}
+	if len(c.Properties) > 0 {
+		component.Properties = &properties{Properties: c.Properties}
+	}
+
+	return e.EncodeElement(component, start)
+}
+
+// Hash is a hash of a component's content.
+type Hash struct {
+	Algorithm string `json:"alg" xml:"alg,attr"`
+	Content   string `json:"content" xml:",chardata"`
+}
+
+// Property is a name-value pair which CycloneDX has no dedicated field for.
+// A name may be repeated.
+type Property struct {
+	Name  string `json:"name" xml:"name,attr"`
+	Value string `json:"value" xml:",chardata"`
+}
+
+// Dependency lists the components which the component Ref depends on.
+type Dependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// MarshalXML encodes d in the form of the XML schema, in which each component
+// depended on is a nested dependency.
+func (d Dependency) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type nested struct {
+		Ref string `xml:"ref,attr"`
+	}
+	dependency := struct {
+		Ref       string   `xml:"ref,attr"`
+		DependsOn []nested `xml:"dependency"`
+	}{Ref: d.Ref}
+	for _, ref := range d.DependsOn {
+		dependency.DependsOn = append(dependency.DependsOn, nested{Ref: ref})
+	}
+
+	return e.EncodeElement(dependency, start)
+}
+
+// Options describe the BOM produced by FromManifest.
+type Options struct {
+	// Name is the name of the discovered workload.
+	Name string
+
+	// ToolVersion is the version of this tool.
+	ToolVersion string
+
+	// Timestamp is when the BOM was produced.
+	Timestamp time.Time
+}
+
+// FromManifest returns the BOM of the workload m describes. Each image is a
+// container component, which the OLM operators and Helm releases deploying it
+// depend on. The workload itself depends on those, and on the images whose
+// deployer is unknown.
+func FromManifest(m discovery.Manifest, opts Options) BOM {
+	bom := BOM{
+		XMLNS:       xmlNamespace,
+		BOMFormat:   bomFormat,
+		SpecVersion: SpecVersion,
+		Version:     1,
+		Metadata: Metadata{
+			Timestamp: opts.Timestamp.UTC().Format(time.RFC3339),
+			Tools: Tools{Components: []Component{
+				{Type: componentTypeApplication, Name: toolName, Version: opts.ToolVersion},
+			}},
+			Component: Component{Type: componentTypeApplication, BOMRef: workloadRef, Name: opts.Name},
+		},
+		Components: []Component{},
+	}
+
+	owners := map[string]Component{}
+	dependsOn := map[string][]string{}
+	addDependency := func(ref, dependency string) {
+		if !slices.Contains(dependsOn[ref], dependency) {
+			dependsOn[ref] = append(dependsOn[ref], dependency)
+		}
+	}
+
+	for _, image := range m.DiscoveredImages {
+		component := containerComponent(image)
+		if slices.ContainsFunc(bom.Components, func(c Component) bool { return c.BOMRef == component.BOMRef }) {
+			continue
+		}
+		bom.Components = append(bom.Components, component)
+
+		owned := false
+		for _, c := range image.Containers {
+			for _, owner := range ownerComponents(c) {
+				owners[owner.BOMRef] = owner
+				addDependency(owner.BOMRef, component.BOMRef)
+				owned = true
+			}
+		}
+		if !owned {
+			addDependency(workloadRef, component.BOMRef)
+		}
+	}
+
+	ownerRefs := make([]string, 0, len(owners))
+	for ref := range owners {
+		ownerRefs = append(ownerRefs, ref)
+	}
+	slices.Sort(ownerRefs)
+	for _, ref := range ownerRefs {
+		bom.Components = append(bom.Components, owners[ref])
+		addDependency(workloadRef, ref)
+	}
+
+	refs := []string{workloadRef}
+	for _, component := range bom.Components {
+		refs = append(refs, component.BOMRef)
+	}
+	for _, ref := range refs {
+		bom.Dependencies = append(bom.Dependencies, Dependency{Ref: ref, DependsOn: dependsOn[ref]})
+	}
+
+	return bom
+}
+
+// containerComponent returns the container component of image, identified by
+// its reference.
+func containerComponent(image discovery.DiscoveredImage) Component {
+	component := Component{Type: componentTypeContainer, BOMRef: image.Image, Name: image.Image}
+	ref, err := imageref.Parse(image.Image)
+	if err == nil {
+		digest := ref.Digest
+		if digest == "" && image.Inspection != nil {
+			digest = image.Inspection.Digest
+		}
+
+		component.Name = ref.Name()
+		component.Version = cmp.Or(ref.Tag, digest)
+		component.PURL = packageURL(ref, digest)
+		if algorithm, content, found := strings.Cut(digest, ":"); found && hashAlgorithms[algorithm] != "" {
+			component.Hashes = []Hash{{Algorithm: hashAlgorithms[algorithm], Content: content}}
+		}
+	}
+
+	for _, c := range image.Containers {
+		component.Properties = append(component.Properties,
+			Property{Name: propertyPrefix + "namespace", Value: c.Pod.Namespace},
+			Property{Name: propertyPrefix + "pod", Value: c.Pod.Name},
+			Property{Name: propertyPrefix + "container", Value: c.Name},
+			Property{Name: propertyPrefix + "type", Value: c.Type},
+		)
+	}
+
+	return component
+}
+
+// packageURL returns the pkg:oci package URL of ref, versioned by digest when
+// it is known.
+func packageURL(ref imageref.Reference, digest string) string {
+	purl := "pkg:oci/" + url.PathEscape(strings.ToLower(path.Base(ref.Repository)))
+	if digest != "" {
+		// The version is percent-encoded, including the colon of the digest.
+		purl += "@" + url.QueryEscape(digest)
+	}
+
+	qualifiers := url.Values{}
+	qualifiers.Set("repository_url", strings.ToLower(ref.Name()))
+	if ref.Tag != "" {
+		qualifiers.Set("tag", ref.Tag)
+	}
+
+	return purl + "?" + qualifiers.Encode()
+}
+
+// ownerComponents returns the application components of the OLM operator and
+// Helm release which deployed c, if they are known.
+func ownerComponents(c discovery.DiscoveredContainer) []Component {
+	if c.Component == nil {
+		return nil
+	}
+
+	var owners []Component
+	if csv := c.Component.ClusterServiceVersion; csv != "" {
+		namespace := cmp.Or(c.Component.ClusterServiceVersionNamespace, c.Pod.Namespace)
+		owner := Component{
+			Type:       componentTypeApplication,
+			BOMRef:     "olm:" + namespace + "/" + csv,
+			Name:       csv,
+			Properties: []Property{{Name: propertyPrefix + "namespace", Value: namespace}},
+		}
+		if c.Component.Operator != "" {
+			owner.Properties = append(owner.Properties, Property{Name: propertyPrefix + "operator", Value: c.Component.Operator})
+		}
+		owners = append(owners, owner)
+	}
+
+	if release := c.Component.HelmRelease; release != "" {
+		namespace := cmp.Or(c.Component.HelmReleaseNamespace, c.Pod.Namespace)
+		owner := Component{
+			Type:       componentTypeApplication,
+			BOMRef:     "helm:" + namespace + "/" + release,
+			Name:       release,
+			Version:    c.Component.HelmChartVersion,
+			Properties: []Property{{Name: propertyPrefix + "namespace", Value: namespace}},
+		}
+		if c.Component.HelmChart != "" {
+			owner.Properties = append(owner.Properties, Property{Name: propertyPrefix + "helm-chart", Value: c.Component.HelmChart})
+		}
+		owners = append(owners, owner)
+	}
+
+	return owners
+}
+
+// WriteJSON writes bom to out as CycloneDX JSON.
+func WriteJSON(out io.Writer, bom BOM) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(bom)
+}
+
+// WriteXML writes bom to out as CycloneDX XML.
+func WriteXML(out io.Writer, bom BOM) error {
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(out)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(bom); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(out, "\n")
+	return err
+}
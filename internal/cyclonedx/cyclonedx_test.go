@@ -0,0 +1,175 @@
+package cyclonedx
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// testManifest holds an image deployed by an operator, one by a Helm release
+// and inspected, and one whose deployer is unknown, run by two containers.
+var testManifest = discovery.Manifest{DiscoveredImages: []discovery.DiscoveredImage{
+	{
+		Image: "quay.io/my-org/operator:1.0@" + digest,
+		Containers: []discovery.DiscoveredContainer{{
+			Name: "manager", Type: "Container",
+			Pod:       discovery.DiscoveredPod{Name: "operator-abc", Namespace: "operators"},
+			Component: &discovery.Component{ClusterServiceVersion: "my-operator.v1.0.0", Operator: "my-operator"},
+		}},
+	},
+	{
+		Image:      "registry.example.com/charts/app:2.1",
+		Inspection: &discovery.ImageInspection{Digest: digest},
+		Containers: []discovery.DiscoveredContainer{{
+			Name: "app", Type: "Container",
+			Pod:       discovery.DiscoveredPod{Name: "app-xyz", Namespace: "apps"},
+			Component: &discovery.Component{HelmRelease: "app", HelmChart: "app", HelmChartVersion: "2.1.0"},
+		}},
+	},
+	{
+		Image: "nginx",
+		Containers: []discovery.DiscoveredContainer{
+			{Name: "web", Type: "Container", Pod: discovery.DiscoveredPod{Name: "web-1", Namespace: "apps"}},
+			{Name: "setup", Type: "InitContainer", Pod: discovery.DiscoveredPod{Name: "web-2", Namespace: "apps"}},
+		},
+	},
+}}
+
+func TestFromManifest(t *testing.T) {
+	t.Parallel()
+	bom := FromManifest(testManifest, Options{Name: "prod", ToolVersion: "1.2.3", Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)})
+
+	if bom.Metadata.Timestamp != "2024-01-02T03:04:05Z" || bom.Metadata.Component.Name != "prod" || bom.Metadata.Tools.Components[0].Version != "1.2.3" {
+		t.Fatalf("FromManifest returned unexpected metadata %+v", bom.Metadata)
+	}
+
+	testcases := map[string]struct {
+		ref      string
+		expected Component
+	}{
+		"image by tag and digest": {
+			ref: "quay.io/my-org/operator:1.0@" + digest,
+			expected: Component{
+				Type: "container", Name: "quay.io/my-org/operator", Version: "1.0",
+				PURL:   "pkg:oci/operator@" + "sha256%3A0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef" + "?repository_url=quay.io%2Fmy-org%2Foperator&tag=1.0",
+				Hashes: []Hash{{Algorithm: "SHA-256", Content: digest[len("sha256:"):]}},
+			},
+		},
+		"inspected image": {
+			ref: "registry.example.com/charts/app:2.1",
+			expected: Component{
+				Type: "container", Name: "registry.example.com/charts/app", Version: "2.1",
+				PURL:   "pkg:oci/app@" + "sha256%3A0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef" + "?repository_url=registry.example.com%2Fcharts%2Fapp&tag=2.1",
+				Hashes: []Hash{{Algorithm: "SHA-256", Content: digest[len("sha256:"):]}},
+			},
+		},
+		"image without a digest": {
+			ref: "nginx",
+			expected: Component{
+				Type: "container", Name: "docker.io/library/nginx",
+				PURL: "pkg:oci/nginx?repository_url=docker.io%2Flibrary%2Fnginx",
+				Properties: []Property{
+					{Name: "discover-workload:namespace", Value: "apps"},
+					{Name: "discover-workload:pod", Value: "web-1"},
+					{Name: "discover-workload:container", Value: "web"},
+					{Name: "discover-workload:type", Value: "Container"},
+					{Name: "discover-workload:namespace", Value: "apps"},
+					{Name: "discover-workload:pod", Value: "web-2"},
+					{Name: "discover-workload:container", Value: "setup"},
+					{Name: "discover-workload:type", Value: "InitContainer"},
+				},
+			},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			idx := slices.IndexFunc(bom.Components, func(c Component) bool { return c.BOMRef == tc.ref })
+			if idx < 0 {
+				t.Fatalf("FromManifest did not return a component for %s", tc.ref)
+			}
+			actual := bom.Components[idx]
+			if actual.Type != tc.expected.Type || actual.Name != tc.expected.Name || actual.Version != tc.expected.Version ||
+				actual.PURL != tc.expected.PURL || !slices.Equal(actual.Hashes, tc.expected.Hashes) {
+				t.Fatalf("FromManifest returned %+v; expected %+v", actual, tc.expected)
+			}
+			if tc.expected.Properties != nil && !slices.Equal(actual.Properties, tc.expected.Properties) {
+				t.Fatalf("FromManifest returned properties %v; expected %v", actual.Properties, tc.expected.Properties)
+			}
+		})
+	}
+
+	expected := []Dependency{
+		{Ref: "workload", DependsOn: []string{"nginx", "helm:apps/app", "olm:operators/my-operator.v1.0.0"}},
+		{Ref: "quay.io/my-org/operator:1.0@" + digest},
+		{Ref: "registry.example.com/charts/app:2.1"},
+		{Ref: "nginx"},
+		{Ref: "helm:apps/app", DependsOn: []string{"registry.example.com/charts/app:2.1"}},
+		{Ref: "olm:operators/my-operator.v1.0.0", DependsOn: []string{"quay.io/my-org/operator:1.0@" + digest}},
+	}
+	if !slices.EqualFunc(bom.Dependencies, expected, func(d1, d2 Dependency) bool {
+		return d1.Ref == d2.Ref && slices.Equal(d1.DependsOn, d2.DependsOn)
+	}) {
+		t.Fatalf("FromManifest returned dependencies %v; expected %v", bom.Dependencies, expected)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	if err := WriteJSON(&out, FromManifest(testManifest, Options{Name: "prod"})); err != nil {
+		t.Fatalf("WriteJSON returned an unexpected error: %q", err)
+	}
+
+	written := map[string]any{}
+	if err := json.Unmarshal(out.Bytes(), &written); err != nil {
+		t.Fatalf("WriteJSON wrote invalid JSON: %q", err)
+	}
+	if written["bomFormat"] != "CycloneDX" || written["specVersion"] != "1.5" {
+		t.Fatalf("WriteJSON wrote an unexpected header:\n%s", out.String())
+	}
+}
+
+func TestWriteXML(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	bom := FromManifest(testManifest, Options{Name: "prod"})
+	if err := WriteXML(&out, bom); err != nil {
+		t.Fatalf("WriteXML returned an unexpected error: %q", err)
+	}
+
+	written := struct {
+		XMLName    xml.Name
+		Components []struct {
+			BOMRef string `xml:"bom-ref,attr"`
+			Hashes []Hash `xml:"hashes>hash"`
+		} `xml:"components>component"`
+		Dependencies []struct {
+			Ref       string `xml:"ref,attr"`
+			DependsOn []struct {
+				Ref string `xml:"ref,attr"`
+			} `xml:"dependency"`
+		} `xml:"dependencies>dependency"`
+	}{}
+	if err := xml.Unmarshal(out.Bytes(), &written); err != nil {
+		t.Fatalf("WriteXML wrote invalid XML: %q", err)
+	}
+
+	if written.XMLName.Space != xmlNamespace || written.XMLName.Local != "bom" {
+		t.Fatalf("WriteXML wrote the root element %v", written.XMLName)
+	}
+	if len(written.Components) != len(bom.Components) || !slices.Equal(written.Components[0].Hashes, bom.Components[0].Hashes) {
+		t.Fatalf("WriteXML wrote components %+v; expected %+v", written.Components, bom.Components)
+	}
+	if written.Dependencies[0].Ref != "workload" || len(written.Dependencies[0].DependsOn) != 3 {
+		t.Fatalf("WriteXML wrote dependencies %+v; expected %+v", written.Dependencies, bom.Dependencies)
+	}
+}
@@ -0,0 +1,197 @@
+package discover
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+const (
+	olmOwnerLabel          = "olm.owner"
+	olmOwnerNamespaceLabel = "olm.owner.namespace"
+	olmOwnerKindLabel      = "olm.owner.kind"
+	operatorLabelPrefix    = "operators.coreos.com/"
+
+	helmReleaseNameAnnotation      = "meta.helm.sh/release-name"
+	helmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+	helmChartLabel                 = "helm.sh/chart"
+	managedByLabel                 = "app.kubernetes.io/managed-by"
+	instanceLabel                  = "app.kubernetes.io/instance"
+
+	// maxOwnerDepth bounds how many owner references are followed from a
+	// pod, e.g. to its ReplicaSet and then its Deployment.
+	maxOwnerDepth = 5
+)
+
+// helmChartPattern splits the helm.sh/chart label, e.g. "my-chart-1.2.3", into
+// the chart name and version.
+var helmChartPattern = regexp.MustCompile(`^(.+?)-(v?[0-9]+\.[0-9]+\.[0-9]+.*)$`)
+
+// ComponentResolver returns the Component which deployed p, or nil if it is
+// unknown.
+type ComponentResolver func(ctx context.Context, p *corev1.Pod) *discovery.Component
+
+// NewComponentResolver returns a ComponentResolver which reads the labels and
+// annotations of a pod and of the controllers owning it, which are retrieved
+// with client.
+func NewComponentResolver(client kubernetes.Interface, logger *slog.Logger) ComponentResolver {
+	return func(ctx context.Context, p *corev1.Pod) *discovery.Component {
+		objs := append([]metav1.Object{p}, LookupOwners(ctx, logger, client, p)...)
+		return ComponentFromObjects(objs...)
+	}
+}
+
+// ResolvePodComponent is a ComponentResolver which only reads the labels and
+// annotations of the pod itself, for when its owners are not available.
+func ResolvePodComponent(_ context.Context, p *corev1.Pod) *discovery.Component {
+	return ComponentFromObjects(p)
+}
+
+// ComponentFromObjects returns the Component recorded by OLM or Helm in the
+// labels and annotations of objs. Each field is taken from the first object
+// which sets it, so objs should start with the pod, followed by its owners
+// from nearest to furthest. Nil is returned if no object carries any of them.
+func ComponentFromObjects(objs ...metav1.Object) *discovery.Component {
+	c := discovery.Component{}
+	for _, obj := range objs {
+		labels := obj.GetLabels()
+		if c.ClusterServiceVersion == "" && labels[olmOwnerLabel] != "" {
+			if kind := labels[olmOwnerKindLabel]; kind == "" || kind == "ClusterServiceVersion" {
+				c.ClusterServiceVersion = labels[olmOwnerLabel]
+				c.ClusterServiceVersionNamespace = labels[olmOwnerNamespaceLabel]
+			}
+		}
+
+		if c.Operator == "" {
+			c.Operator = operatorName(labels)
+		}
+
+		if c.HelmRelease == "" {
+			c.HelmRelease, c.HelmReleaseNamespace = helmRelease(obj)
+		}
+
+		if chart := labels[helmChartLabel]; c.HelmChart == "" && chart != "" {
+			c.HelmChart = chart
+			if match := helmChartPattern.FindStringSubmatch(chart); match != nil {
+				c.HelmChart, c.HelmChartVersion = match[1], match[2]
+			}
+		}
+	}
+
+	if c == (discovery.Component{}) {
+		return nil
+	}
+
+	return &c
+}
+
+// operatorName returns the name of the OLM Operator from the first
+// operators.coreos.com/<name> label in labels.
+func operatorName(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if name, found := strings.CutPrefix(key, operatorLabelPrefix); found && name != "" {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// helmRelease returns the name and namespace of the Helm release which
+// installed obj. The release annotations are preferred, then the labels
+// recommended for charts.
+func helmRelease(obj metav1.Object) (string, string) {
+	annotations, labels := obj.GetAnnotations(), obj.GetLabels()
+	if name := annotations[helmReleaseNameAnnotation]; name != "" {
+		namespace := annotations[helmReleaseNamespaceAnnotation]
+		if namespace == "" {
+			namespace = obj.GetNamespace()
+		}
+		return name, namespace
+	}
+
+	if labels[managedByLabel] == "Helm" && labels[instanceLabel] != "" {
+		return labels[instanceLabel], obj.GetNamespace()
+	}
+
+	return "", ""
+}
+
+// LookupOwners returns the controllers owning obj, nearest first, e.g. the
+// ReplicaSet and Deployment of a pod. The chain ends at an owner of a kind
+// without a typed client, or which cannot be retrieved.
+func LookupOwners(ctx context.Context, logger *slog.Logger, client kubernetes.Interface, obj metav1.Object) []metav1.Object {
+	var owners []metav1.Object
+	for range maxOwnerDepth {
+		ref := metav1.GetControllerOfNoCopy(obj)
+		if ref == nil {
+			break
+		}
+
+		owner, err := getOwner(ctx, client, obj.GetNamespace(), *ref)
+		if err != nil {
+			logger.Debug("unable to look up owner", "kind", ref.Kind, "name", ref.Name, "errMsg", err)
+			break
+		}
+		if owner == nil {
+			break
+		}
+
+		owners = append(owners, owner)
+		obj = owner
+	}
+
+	return owners
+}
+
+// getOwner retrieves the object ref refers to, or returns nil if its kind is
+// not supported.
+func getOwner(ctx context.Context, client kubernetes.Interface, namespace string, ref metav1.OwnerReference) (metav1.Object, error) {
+	getOptions := metav1.GetOptions{}
+	switch schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind).GroupKind() {
+	case schema.GroupKind{Group: "apps", Kind: "ReplicaSet"}:
+		return client.AppsV1().ReplicaSets(namespace).Get(ctx, ref.Name, getOptions)
+	case schema.GroupKind{Group: "apps", Kind: "Deployment"}:
+		return client.AppsV1().Deployments(namespace).Get(ctx, ref.Name, getOptions)
+	case schema.GroupKind{Group: "apps", Kind: "StatefulSet"}:
+		return client.AppsV1().StatefulSets(namespace).Get(ctx, ref.Name, getOptions)
+	case schema.GroupKind{Group: "apps", Kind: "DaemonSet"}:
+		return client.AppsV1().DaemonSets(namespace).Get(ctx, ref.Name, getOptions)
+	case schema.GroupKind{Group: "batch", Kind: "Job"}:
+		return client.BatchV1().Jobs(namespace).Get(ctx, ref.Name, getOptions)
+	case schema.GroupKind{Group: "batch", Kind: "CronJob"}:
+		return client.BatchV1().CronJobs(namespace).Get(ctx, ref.Name, getOptions)
+	case schema.GroupKind{Kind: "ReplicationController"}:
+		return client.CoreV1().ReplicationControllers(namespace).Get(ctx, ref.Name, getOptions)
+	default:
+		return nil, nil
+	}
+}
+
+// withComponent records component on every container of images.
+func withComponent(images []discovery.DiscoveredImage, component *discovery.Component) {
+	if component == nil {
+		return
+	}
+
+	for i := range images {
+		for j := range images[i].Containers {
+			images[i].Containers[j].Component = component
+		}
+	}
+}
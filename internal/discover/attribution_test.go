@@ -0,0 +1,124 @@
+package discover
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func TestComponentFromObjects(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		objs     []metav1.Object
+		expected *discovery.Component
+	}{
+		"no metadata": {
+			objs:     []metav1.Object{&corev1.Pod{}},
+			expected: nil,
+		},
+		"olm labels": {
+			objs: []metav1.Object{&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+				olmOwnerLabel:          "operator.v1.2.0",
+				olmOwnerNamespaceLabel: "operators",
+				olmOwnerKindLabel:      "ClusterServiceVersion",
+				operatorLabelPrefix + "my-operator.operators": "",
+			}}}},
+			expected: &discovery.Component{
+				ClusterServiceVersion:          "operator.v1.2.0",
+				ClusterServiceVersionNamespace: "operators",
+				Operator:                       "my-operator.operators",
+			},
+		},
+		"olm owner of another kind": {
+			objs: []metav1.Object{&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+				olmOwnerLabel:     "global-operators",
+				olmOwnerKindLabel: "OperatorGroup",
+			}}}},
+			expected: nil,
+		},
+		"helm annotations and chart label": {
+			objs: []metav1.Object{
+				&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+					Namespace: "apps",
+					Labels:    map[string]string{helmChartLabel: "my-chart-1.2.3-rc.1"},
+				}},
+				&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "apps",
+					Annotations: map[string]string{helmReleaseNameAnnotation: "release", helmReleaseNamespaceAnnotation: "releases"},
+					Labels:      map[string]string{helmChartLabel: "other-chart-0.0.1"},
+				}},
+			},
+			expected: &discovery.Component{
+				HelmRelease:          "release",
+				HelmReleaseNamespace: "releases",
+				HelmChart:            "my-chart",
+				HelmChartVersion:     "1.2.3-rc.1",
+			},
+		},
+		"helm labels": {
+			objs: []metav1.Object{&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "apps",
+				Labels:    map[string]string{managedByLabel: "Helm", instanceLabel: "release", helmChartLabel: "unversioned"},
+			}}},
+			expected: &discovery.Component{
+				HelmRelease:          "release",
+				HelmReleaseNamespace: "apps",
+				HelmChart:            "unversioned",
+			},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			actual := ComponentFromObjects(tc.objs...)
+			if (actual == nil) != (tc.expected == nil) || (actual != nil && *actual != *tc.expected) {
+				t.Fatalf("ComponentFromObjects returned %+v; expected %+v", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNewComponentResolver(t *testing.T) {
+	t.Parallel()
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app",
+		Namespace:   "apps",
+		Annotations: map[string]string{helmReleaseNameAnnotation: "release"},
+	}}
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name:            "app-5d8f",
+		Namespace:       "apps",
+		OwnerReferences: []metav1.OwnerReference{controllerRef("apps/v1", "Deployment", "app")},
+	}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            "app-5d8f-x2x9",
+		Namespace:       "apps",
+		OwnerReferences: []metav1.OwnerReference{controllerRef("apps/v1", "ReplicaSet", "app-5d8f")},
+	}}
+
+	resolve := NewComponentResolver(fake.NewClientset(deployment, replicaSet), NewSlogDiscardLogger())
+	actual := resolve(context.TODO(), pod)
+	expected := discovery.Component{HelmRelease: "release", HelmReleaseNamespace: "apps"}
+	if actual == nil || *actual != expected {
+		t.Fatalf("resolver returned %+v; expected %+v", actual, expected)
+	}
+
+	// A missing owner ends the lookup without failing.
+	orphan := pod.DeepCopy()
+	orphan.OwnerReferences = []metav1.OwnerReference{controllerRef("apps/v1", "ReplicaSet", "missing")}
+	if actual := resolve(context.TODO(), orphan); actual != nil {
+		t.Fatalf("resolver returned %+v for a pod without owners", actual)
+	}
+}
+
+func controllerRef(apiVersion, kind, name string) metav1.OwnerReference {
+	isController := true
+	return metav1.OwnerReference{APIVersion: apiVersion, Kind: kind, Name: name, Controller: &isController}
+}
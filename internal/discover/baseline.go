@@ -0,0 +1,72 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+// BaselineReport is the result of checking a discovered Manifest against a
+// baseline Manifest of allowed images.
+type BaselineReport struct {
+	// Passed is false if any unknown images were found, or if missing images
+	// were found and CheckMissing was requested.
+	Passed bool
+
+	// Unknown lists discovered images that are not part of the baseline.
+	Unknown []discovery.DiscoveredImage
+
+	// Missing lists baseline images that were not discovered. It is only
+	// populated if CheckMissing was requested.
+	Missing []string `json:",omitempty"`
+}
+
+// BaselineOptions configure CheckBaseline.
+type BaselineOptions struct {
+	// CheckMissing also fails the check if images in the baseline were not
+	// discovered.
+	CheckMissing bool
+}
+
+// CheckBaseline compares discovered against the allowed images in baseline.
+// Images are compared by their normalized reference.
+func CheckBaseline(baseline, discovered discovery.Manifest, opts BaselineOptions) BaselineReport {
+	baseline, discovered = SortManifest(baseline, SortByImage), SortManifest(discovered, SortByImage)
+	// Unknown is always encoded as a list so that consumers of the report do
+	// not need to handle null.
+	report := BaselineReport{Unknown: []discovery.DiscoveredImage{}}
+
+	allowed := imagesByReference(baseline)
+	for _, image := range discovered.DiscoveredImages {
+		if _, found := allowed[imageref.Normalize(image.Image)]; !found {
+			report.Unknown = append(report.Unknown, image)
+		}
+	}
+
+	if opts.CheckMissing {
+		found := imagesByReference(discovered)
+		for _, image := range baseline.DiscoveredImages {
+			if _, ok := found[imageref.Normalize(image.Image)]; !ok && !slices.Contains(report.Missing, image.Image) {
+				report.Missing = append(report.Missing, image.Image)
+			}
+		}
+	}
+
+	report.Passed = len(report.Unknown) == 0 && len(report.Missing) == 0
+	return report
+}
+
+// WriteBaselineReport writes report to out as JSON.
+func WriteBaselineReport(out io.Writer, report BaselineReport) error {
+	reportJSON, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, string(reportJSON))
+	return err
+}
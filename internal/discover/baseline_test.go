@@ -0,0 +1,83 @@
+package discover
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func TestCheckBaseline(t *testing.T) {
+	t.Parallel()
+	baseline := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{Image: "docker.io/library/nginx:latest"},
+			{Image: "example.com/org/operator:1"},
+			{Image: "example.com/org/optional:1"},
+		},
+	}
+	discovered := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{Image: "nginx"},
+			{Image: "example.com/org/operator:1"},
+			{Image: "example.com/org/unexpected:1"},
+		},
+	}
+
+	testcases := map[string]struct {
+		opts            BaselineOptions
+		expectedPassed  bool
+		expectedUnknown []string
+		expectedMissing []string
+	}{
+		"unknown only": {
+			opts:            BaselineOptions{},
+			expectedUnknown: []string{"example.com/org/unexpected:1"},
+		},
+		"unknown and missing": {
+			opts:            BaselineOptions{CheckMissing: true},
+			expectedUnknown: []string{"example.com/org/unexpected:1"},
+			expectedMissing: []string{"example.com/org/optional:1"},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			report := CheckBaseline(baseline, discovered, tc.opts)
+			if report.Passed != tc.expectedPassed {
+				t.Errorf("CheckBaseline returned Passed=%t; expected %t", report.Passed, tc.expectedPassed)
+			}
+
+			if unknown := imageNames(report.Unknown); !slices.Equal(unknown, tc.expectedUnknown) {
+				t.Errorf("CheckBaseline returned unknown images %v; expected %v", unknown, tc.expectedUnknown)
+			}
+
+			if !slices.Equal(report.Missing, tc.expectedMissing) {
+				t.Errorf("CheckBaseline returned missing images %v; expected %v", report.Missing, tc.expectedMissing)
+			}
+		})
+	}
+}
+
+func TestCheckBaselinePassed(t *testing.T) {
+	t.Parallel()
+	m := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{{Image: "example.com/org/operator:1"}},
+	}
+
+	report := CheckBaseline(m, m, BaselineOptions{CheckMissing: true})
+	if !report.Passed {
+		t.Fatalf("CheckBaseline failed a manifest against itself: %v", report)
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := WriteBaselineReport(buffer, report); err != nil {
+		t.Fatalf("WriteBaselineReport returned an unexpected error: %q", err)
+	}
+	if !strings.Contains(buffer.String(), `"Passed": true`) {
+		t.Fatalf("WriteBaselineReport wrote an unexpected report: %s", buffer.String())
+	}
+}
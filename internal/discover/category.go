@@ -0,0 +1,157 @@
+package discover
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+// ImageCategories lists every discovery.ImageCategory, in the order used by
+// SortByCategory.
+var ImageCategories = []discovery.ImageCategory{
+	discovery.ImageCategoryProduct,
+	discovery.ImageCategoryRedHat,
+	discovery.ImageCategoryPlatform,
+	discovery.ImageCategoryThirdParty,
+}
+
+// RegistryRule assigns a category to the images whose repository matches a
+// pattern.
+type RegistryRule struct {
+	// Pattern matches the fully qualified repository name of an image, e.g.
+	// "quay.io/my-org/operator". A pattern also matches every repository
+	// below it, so "registry.redhat.io" matches all of its images. Shell
+	// patterns, such as "quay.io/my-org/app-*", are supported.
+	Pattern string `json:"pattern"`
+
+	// Category is assigned to the images matching Pattern.
+	Category discovery.ImageCategory `json:"category"`
+}
+
+// registryRulesFile is the shape of a rules file read by
+// ReadRegistryRulesFile.
+type registryRulesFile struct {
+	Rules []RegistryRule `json:"rules"`
+}
+
+// DefaultRegistryRules categorize the images of well-known Red Hat and
+// OpenShift registries.
+var DefaultRegistryRules = []RegistryRule{
+	{Pattern: "quay.io/openshift-release-dev", Category: discovery.ImageCategoryPlatform},
+	{Pattern: "quay.io/openshift", Category: discovery.ImageCategoryPlatform},
+	{Pattern: "registry.redhat.io/openshift4", Category: discovery.ImageCategoryPlatform},
+	{Pattern: "registry.redhat.io", Category: discovery.ImageCategoryRedHat},
+	{Pattern: "registry.access.redhat.com", Category: discovery.ImageCategoryRedHat},
+	{Pattern: "registry.connect.redhat.com", Category: discovery.ImageCategoryThirdParty},
+}
+
+// ParseImageCategories validates each of categories as a
+// discovery.ImageCategory.
+func ParseImageCategories(categories []string) ([]discovery.ImageCategory, error) {
+	for _, category := range categories {
+		if !slices.Contains(ImageCategories, category) {
+			return nil, fmt.Errorf("unsupported image category %q, must be one of %v", category, ImageCategories)
+		}
+	}
+
+	return categories, nil
+}
+
+// ReadRegistryRulesFile decodes the YAML or JSON encoded registry rules
+// stored at path, in the form:
+//
+//	rules:
+//	- pattern: quay.io/my-org
+//	  category: product
+func ReadRegistryRulesFile(rulesPath string) ([]RegistryRule, error) {
+	content, err := os.ReadFile(rulesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := registryRulesFile{}
+	if err := yaml.UnmarshalStrict(content, &rules); err != nil {
+		return nil, fmt.Errorf("unable to decode registry rules %s: %w", rulesPath, err)
+	}
+
+	for idx, rule := range rules.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("registry rule %d in %s is invalid: %w", idx, rulesPath, err)
+		}
+	}
+
+	return rules.Rules, nil
+}
+
+func (r RegistryRule) validate() error {
+	if r.Pattern == "" {
+		return errors.New("pattern is required")
+	}
+	if _, err := path.Match(r.Pattern, ""); err != nil {
+		return fmt.Errorf("pattern %q is malformed: %w", r.Pattern, err)
+	}
+	if _, err := ParseImageCategories([]string{r.Category}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Matches reports whether the repository of image matches r.
+func (r RegistryRule) Matches(image string) bool {
+	name := image
+	if ref, err := imageref.Parse(image); err == nil {
+		name = ref.Name()
+	}
+
+	pattern := strings.TrimSuffix(r.Pattern, "/")
+	for candidate := name; candidate != "." && candidate != "/"; candidate = path.Dir(candidate) {
+		if matched, _ := path.Match(pattern, candidate); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Categorize returns a copy of m in which each image is assigned the category
+// of the first of rules matching its origin. Images no rule matches are
+// categorized as discovery.ImageCategoryThirdParty.
+func Categorize(m discovery.Manifest, rules []RegistryRule) discovery.Manifest {
+	categorized := discovery.Manifest{
+		DiscoveredImages: make([]discovery.DiscoveredImage, 0, len(m.DiscoveredImages)),
+	}
+	for _, image := range m.DiscoveredImages {
+		image.Category = discovery.ImageCategoryThirdParty
+		for _, rule := range rules {
+			if rule.Matches(image.Origin()) {
+				image.Category = rule.Category
+				break
+			}
+		}
+		categorized.DiscoveredImages = append(categorized.DiscoveredImages, image)
+	}
+
+	return categorized
+}
+
+// FilterCategories returns a copy of m with only the images whose category is
+// one of categories.
+func FilterCategories(m discovery.Manifest, categories []discovery.ImageCategory) discovery.Manifest {
+	filtered := discovery.Manifest{}
+	for _, image := range m.DiscoveredImages {
+		if slices.Contains(categories, image.Category) {
+			filtered.DiscoveredImages = append(filtered.DiscoveredImages, image)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,75 @@
+package discover
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func TestCategorize(t *testing.T) {
+	t.Parallel()
+	rulesPath := filepath.Join(t.TempDir(), "rules.yaml")
+	rules := "rules:\n- pattern: quay.io/my-org\n  category: product\n- pattern: quay.io/partner/app-*\n  category: product\n"
+	if err := os.WriteFile(rulesPath, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	custom, err := ReadRegistryRulesFile(rulesPath)
+	if err != nil {
+		t.Fatalf("ReadRegistryRulesFile returned an unexpected error: %q", err)
+	}
+
+	m := discovery.Manifest{}
+	expected := map[string]discovery.ImageCategory{
+		"quay.io/my-org/operator:1":                             discovery.ImageCategoryProduct,
+		"quay.io/my-org/team/operand:1":                         discovery.ImageCategoryProduct,
+		"quay.io/partner/app-server:2":                          discovery.ImageCategoryProduct,
+		"quay.io/partner/db:2":                                  discovery.ImageCategoryThirdParty,
+		"quay.io/my-org-fork/operator:1":                        discovery.ImageCategoryThirdParty,
+		"registry.redhat.io/ubi9/ubi-minimal:latest":            discovery.ImageCategoryRedHat,
+		"registry.redhat.io/openshift4/ose-kube-rbac-proxy:4.1": discovery.ImageCategoryPlatform,
+		"quay.io/openshift-release-dev/ocp-release:4.16.0":      discovery.ImageCategoryPlatform,
+		"nginx:1.25": discovery.ImageCategoryThirdParty,
+	}
+	for image := range expected {
+		m.DiscoveredImages = append(m.DiscoveredImages, discovery.DiscoveredImage{Image: image})
+	}
+
+	categorized := Categorize(m, slices.Concat(custom, DefaultRegistryRules))
+	for _, image := range categorized.DiscoveredImages {
+		if image.Category != expected[image.Image] {
+			t.Errorf("image %s was categorized as %q; expected %q", image.Image, image.Category, expected[image.Image])
+		}
+	}
+
+	products := FilterCategories(categorized, []discovery.ImageCategory{discovery.ImageCategoryProduct})
+	if len(products.DiscoveredImages) != 3 {
+		t.Errorf("FilterCategories returned %v; expected the 3 product images", products.DiscoveredImages)
+	}
+
+	sorted := SortManifest(categorized, SortByCategory)
+	var order []string
+	for _, image := range sorted.DiscoveredImages {
+		if len(order) == 0 || order[len(order)-1] != image.Category {
+			order = append(order, image.Category)
+		}
+	}
+	if !slices.Equal(order, ImageCategories) {
+		t.Errorf("SortManifest grouped categories as %v; expected %v", order, ImageCategories)
+	}
+}
+
+func TestReadRegistryRulesFileRejectsUnknownCategory(t *testing.T) {
+	t.Parallel()
+	rulesPath := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(rulesPath, []byte("rules:\n- pattern: quay.io/my-org\n  category: ours\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadRegistryRulesFile(rulesPath); err == nil {
+		t.Fatal("ReadRegistryRulesFile accepted an unknown category")
+	}
+}
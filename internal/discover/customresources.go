@@ -0,0 +1,164 @@
+package discover
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sdiscovery "k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+// customResourceReferencePrefix prefixes the ReferencedBy value of images
+// found in custom resources.
+const customResourceReferencePrefix = "cr:"
+
+// ParseGroupVersionResource parses a resource in the resource.version.group
+// form, e.g. memcacheds.v1beta1.cache.example.com.
+func ParseGroupVersionResource(s string) (schema.GroupVersionResource, error) {
+	gvr, _ := schema.ParseResourceArg(s)
+	if gvr == nil || gvr.Resource == "" || gvr.Version == "" {
+		return schema.GroupVersionResource{}, fmt.Errorf("resource %q must be in the resource.version.group form", s)
+	}
+
+	return *gvr, nil
+}
+
+// FindCustomResourceImages lists the custom resources of each of gvrs in
+// namespaces, and returns the image references found in their fields. The
+// scope of each resource is looked up with resources, and cluster-scoped
+// resources are listed once rather than in each namespace. Each image is
+// recorded as referenced by the kind, name, and path of the field it was found
+// in, e.g. "cr:Memcached/example:.spec.image".
+func FindCustomResourceImages(
+	ctx context.Context,
+	logger *slog.Logger,
+	client dynamic.Interface,
+	resources k8sdiscovery.ServerResourcesInterface,
+	gvrs []schema.GroupVersionResource,
+	namespaces []string,
+) (discovery.Manifest, error) {
+	m := discovery.Manifest{}
+	for _, gvr := range gvrs {
+		namespaced, err := isNamespaced(resources, gvr)
+		if err != nil {
+			return discovery.Manifest{}, err
+		}
+
+		if !namespaced {
+			logger.Debug("listing cluster-scoped resource once", "resource", gvr.GroupResource())
+			list, err := client.Resource(gvr).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return discovery.Manifest{}, fmt.Errorf("unable to list %s: %w", gvr.GroupResource(), err)
+			}
+
+			for i := range list.Items {
+				m = appendToManifest(m, processCustomResource(&list.Items[i], logger)...)
+			}
+			continue
+		}
+
+		for _, ns := range namespaces {
+			list, err := client.Resource(gvr).Namespace(ns).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return discovery.Manifest{}, fmt.Errorf("unable to list %s in namespace %s: %w", gvr.GroupResource(), ns, err)
+			}
+
+			for i := range list.Items {
+				m = appendToManifest(m, processCustomResource(&list.Items[i], logger)...)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// isNamespaced reports whether the server serves gvr as a namespaced resource.
+func isNamespaced(resources k8sdiscovery.ServerResourcesInterface, gvr schema.GroupVersionResource) (bool, error) {
+	list, err := resources.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false, fmt.Errorf("unable to discover the resources of %s: %w", gvr.GroupVersion(), err)
+	}
+
+	for _, resource := range list.APIResources {
+		if resource.Name == gvr.Resource {
+			return resource.Namespaced, nil
+		}
+	}
+
+	return false, fmt.Errorf("the server does not serve %s in %s", gvr.Resource, gvr.GroupVersion())
+}
+
+// processCustomResource produces DiscoveredImages for every string field of
+// obj which looks like an image reference. Metadata is not searched, nor are
+// apiVersion and kind fields, since API groups look like registry hosts.
+func processCustomResource(obj *unstructured.Unstructured, logger *slog.Logger) []discovery.DiscoveredImage {
+	var found []discovery.DiscoveredImage
+	var walk func(value any, path string, key string)
+	walk = func(value any, path string, key string) {
+		switch v := value.(type) {
+		case map[string]any:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			slices.Sort(keys)
+			for _, k := range keys {
+				if (path == "" && k == "metadata") || k == "apiVersion" || k == "kind" {
+					continue
+				}
+				walk(v[k], path+"."+k, k)
+			}
+		case []any:
+			for idx, item := range v {
+				walk(item, fmt.Sprintf("%s[%d]", path, idx), key)
+			}
+		case string:
+			if !looksLikeImage(v, key) {
+				return
+			}
+
+			logger.Debug("found an image in a custom resource", "kind", obj.GetKind(), "name", obj.GetName(), "path", path, "image", v)
+			found = append(found, discovery.DiscoveredImage{
+				Image: v,
+				Containers: []discovery.DiscoveredContainer{{
+					ReferencedBy: fmt.Sprintf("%s%s/%s:%s", customResourceReferencePrefix, obj.GetKind(), obj.GetName(), path),
+					Pod: discovery.DiscoveredPod{
+						Name:      obj.GetName(),
+						Namespace: obj.GetNamespace(),
+					},
+				}},
+			})
+		}
+	}
+	walk(obj.Object, "", "")
+
+	return found
+}
+
+// looksLikeImage reports whether s, the value of the field key, is an image
+// reference. Most short strings parse as references, so outside of fields
+// named like "image", a repository path and either a tag, a digest, or a
+// registry host are also required.
+func looksLikeImage(s, key string) bool {
+	ref, err := imageref.Parse(s)
+	if err != nil {
+		return false
+	}
+
+	if strings.Contains(strings.ToLower(key), "image") {
+		return true
+	}
+
+	name, _, _ := strings.Cut(s, "@")
+	hasRegistry := ref.Registry != imageref.DefaultRegistry || strings.HasPrefix(s, imageref.DefaultRegistry+"/")
+	return (strings.Contains(name, "/") || ref.Digest != "") && (ref.Tag != "" || ref.Digest != "" || hasRegistry)
+}
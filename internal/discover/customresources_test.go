@@ -0,0 +1,187 @@
+package discover
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func TestFindCustomResourceImages(t *testing.T) {
+	t.Parallel()
+	gvr, err := ParseGroupVersionResource("memcacheds.v1beta1.cache.example.com")
+	if err != nil {
+		t.Fatalf("ParseGroupVersionResource returned an unexpected error: %q", err)
+	}
+
+	cr := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "cache.example.com/v1beta1",
+		"kind":       "Memcached",
+		"metadata": map[string]any{
+			"name":        "example",
+			"namespace":   "ns",
+			"annotations": map[string]any{"source": "example.com/org/ignored:1"},
+		},
+		"spec": map[string]any{
+			"image":   "memcached:1.6",
+			"version": map[string]any{"image": "example.com/org/memcached@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+			"sidecars": []any{
+				map[string]any{"name": "exporter", "ref": "quay.io/org/exporter:2"},
+			},
+			"apiVersion": "apps/v1",
+			"schedule":   "10:30",
+			"size":       int64(3),
+		},
+	}}
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "MemcachedList"},
+		cr,
+	)
+
+	resources := newFakeResources(gvr, true)
+
+	m, err := FindCustomResourceImages(context.TODO(), NewSlogDiscardLogger(), client, resources, []schema.GroupVersionResource{gvr}, []string{"ns"})
+	if err != nil {
+		t.Fatalf("FindCustomResourceImages returned an unexpected error: %q", err)
+	}
+
+	pod := discovery.DiscoveredPod{Name: "example", Namespace: "ns"}
+	expected := []discovery.DiscoveredImage{
+		{
+			Image:      "memcached:1.6",
+			Containers: []discovery.DiscoveredContainer{{Pod: pod, ReferencedBy: "cr:Memcached/example:.spec.image"}},
+		},
+		{
+			Image:      "quay.io/org/exporter:2",
+			Containers: []discovery.DiscoveredContainer{{Pod: pod, ReferencedBy: "cr:Memcached/example:.spec.sidecars[0].ref"}},
+		},
+		{
+			Image:      "example.com/org/memcached@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			Containers: []discovery.DiscoveredContainer{{Pod: pod, ReferencedBy: "cr:Memcached/example:.spec.version.image"}},
+		},
+	}
+
+	if !slices.EqualFunc(m.DiscoveredImages, expected, imagesEqual) {
+		t.Fatalf("FindCustomResourceImages returned %+v; expected %+v", m.DiscoveredImages, expected)
+	}
+}
+
+func TestFindCustomResourceImagesClusterScoped(t *testing.T) {
+	t.Parallel()
+	gvr, err := ParseGroupVersionResource("memcachedconfigs.v1beta1.cache.example.com")
+	if err != nil {
+		t.Fatalf("ParseGroupVersionResource returned an unexpected error: %q", err)
+	}
+
+	cr := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "cache.example.com/v1beta1",
+		"kind":       "MemcachedConfig",
+		"metadata":   map[string]any{"name": "cluster"},
+		"spec":       map[string]any{"image": "memcached:1.6"},
+	}}
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "MemcachedConfigList"},
+		cr,
+	)
+	resources := newFakeResources(gvr, false)
+
+	m, err := FindCustomResourceImages(context.TODO(), NewSlogDiscardLogger(), client, resources, []schema.GroupVersionResource{gvr}, []string{"ns1", "ns2"})
+	if err != nil {
+		t.Fatalf("FindCustomResourceImages returned an unexpected error: %q", err)
+	}
+
+	expected := []discovery.DiscoveredImage{
+		{
+			Image:      "memcached:1.6",
+			Containers: []discovery.DiscoveredContainer{{Pod: discovery.DiscoveredPod{Name: "cluster"}, ReferencedBy: "cr:MemcachedConfig/cluster:.spec.image"}},
+		},
+	}
+
+	if !slices.EqualFunc(m.DiscoveredImages, expected, imagesEqual) {
+		t.Fatalf("FindCustomResourceImages returned %+v; expected %+v", m.DiscoveredImages, expected)
+	}
+
+	lists := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "list" {
+			lists++
+			if action.GetNamespace() != "" {
+				t.Fatalf("FindCustomResourceImages listed a cluster-scoped resource in namespace %q", action.GetNamespace())
+			}
+		}
+	}
+	if lists != 1 {
+		t.Fatalf("FindCustomResourceImages listed a cluster-scoped resource %d times; expected once", lists)
+	}
+}
+
+func TestFindCustomResourceImagesUnknownResource(t *testing.T) {
+	t.Parallel()
+	gvr, err := ParseGroupVersionResource("memcacheds.v1beta1.cache.example.com")
+	if err != nil {
+		t.Fatalf("ParseGroupVersionResource returned an unexpected error: %q", err)
+	}
+
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	resources := newFakeResources(schema.GroupVersionResource{Group: gvr.Group, Version: gvr.Version, Resource: "others"}, true)
+
+	_, err = FindCustomResourceImages(context.TODO(), NewSlogDiscardLogger(), client, resources, []schema.GroupVersionResource{gvr}, []string{"ns"})
+	if err == nil {
+		t.Fatal("FindCustomResourceImages did not return an error for a resource the server does not serve")
+	}
+}
+
+// newFakeResources returns a discovery client serving gvr, in the scope
+// given by namespaced.
+func newFakeResources(gvr schema.GroupVersionResource, namespaced bool) *discoveryfake.FakeDiscovery {
+	return &discoveryfake.FakeDiscovery{Fake: &k8stesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: gvr.GroupVersion().String(),
+			APIResources: []metav1.APIResource{{Name: gvr.Resource, Namespaced: namespaced}},
+		},
+	}}}
+}
+
+func TestParseGroupVersionResource(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		resource    string
+		expected    schema.GroupVersionResource
+		expectError bool
+	}{
+		"resource, version and group": {
+			resource: "memcacheds.v1beta1.cache.example.com",
+			expected: schema.GroupVersionResource{Group: "cache.example.com", Version: "v1beta1", Resource: "memcacheds"},
+		},
+		"missing version": {
+			resource:    "memcacheds",
+			expectError: true,
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			actual, err := ParseGroupVersionResource(tc.resource)
+			if (err != nil) != tc.expectError {
+				t.Fatalf("ParseGroupVersionResource returned error %v; expected an error: %t", err, tc.expectError)
+			}
+			if actual != tc.expected {
+				t.Fatalf("ParseGroupVersionResource returned %v; expected %v", actual, tc.expected)
+			}
+		})
+	}
+}
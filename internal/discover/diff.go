@@ -0,0 +1,360 @@
+package discover
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+// DiffFormat is the format in which a ManifestDiff is written.
+type DiffFormat = string
+
+const (
+	DiffFormatText     DiffFormat = "text"
+	DiffFormatJSON     DiffFormat = "json"
+	DiffFormatMarkdown DiffFormat = "markdown"
+)
+
+// DiffFormats lists all supported DiffFormat values.
+var DiffFormats = []DiffFormat{DiffFormatText, DiffFormatJSON, DiffFormatMarkdown}
+
+// ManifestDiff describes the differences between two manifests.
+type ManifestDiff struct {
+	// Added lists images only found in the new manifest.
+	Added []discovery.DiscoveredImage
+
+	// Removed lists images only found in the old manifest.
+	Removed []discovery.DiscoveredImage
+
+	// Changed lists repositories whose images are found in both manifests,
+	// but with a different tag or digest.
+	Changed []ChangedImage
+
+	// Moved lists containers that are found in both manifests, but use a
+	// different image in the new manifest. Containers are matched by their
+	// namespace, name and type rather than by pod, as the pods of most
+	// workloads are named with a random suffix which differs between runs.
+	Moved []MovedContainer
+}
+
+// ChangedImage is a repository that is referenced with a different tag or
+// digest in the new manifest.
+type ChangedImage struct {
+	// Repository is the fully qualified repository name, without tag or
+	// digest.
+	Repository string
+
+	// From lists the images of the repository only found in the old manifest.
+	From []string
+
+	// To lists the images of the repository only found in the new manifest.
+	To []string
+}
+
+// MovedContainer is a container which uses a different image in the new
+// manifest. Container is the container as found in the old manifest.
+type MovedContainer struct {
+	Container discovery.DiscoveredContainer
+	From      string
+	To        string
+}
+
+// HasDifferences reports whether the compared manifests differ.
+func (d ManifestDiff) HasDifferences() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Changed) > 0 || len(d.Moved) > 0
+}
+
+// DiffManifests compares the images and containers in oldM and newM. Images
+// are compared by their normalized reference.
+func DiffManifests(oldM, newM discovery.Manifest) ManifestDiff {
+	oldM, newM = SortManifest(oldM, SortByImage), SortManifest(newM, SortByImage)
+	diff := ManifestDiff{}
+
+	oldImages := imagesByReference(oldM)
+	newImages := imagesByReference(newM)
+
+	// Images only present on one side are grouped by repository so that tag or
+	// digest changes can be told apart from additions and removals.
+	removedByRepo := map[string][]discovery.DiscoveredImage{}
+	for _, image := range oldM.DiscoveredImages {
+		if _, found := newImages[imageref.Normalize(image.Image)]; !found {
+			repo := repositoryOf(image.Image)
+			removedByRepo[repo] = append(removedByRepo[repo], image)
+		}
+	}
+	addedByRepo := map[string][]discovery.DiscoveredImage{}
+	for _, image := range newM.DiscoveredImages {
+		if _, found := oldImages[imageref.Normalize(image.Image)]; !found {
+			repo := repositoryOf(image.Image)
+			addedByRepo[repo] = append(addedByRepo[repo], image)
+		}
+	}
+
+	for repo, removed := range removedByRepo {
+		added, found := addedByRepo[repo]
+		if !found {
+			diff.Removed = append(diff.Removed, removed...)
+			continue
+		}
+		diff.Changed = append(diff.Changed, ChangedImage{
+			Repository: repo,
+			From:       imageNames(removed),
+			To:         imageNames(added),
+		})
+	}
+	for repo, added := range addedByRepo {
+		if _, found := removedByRepo[repo]; !found {
+			diff.Added = append(diff.Added, added...)
+		}
+	}
+	slices.SortFunc(diff.Added, compareImagesByReference)
+	slices.SortFunc(diff.Removed, compareImagesByReference)
+	slices.SortFunc(diff.Changed, func(a, b ChangedImage) int {
+		return cmp.Compare(a.Repository, b.Repository)
+	})
+
+	oldUses, newUses := containerUses(oldM), containerUses(newM)
+	for key, oldImages := range oldUses {
+		newImages, found := newUses[key]
+		if !found {
+			continue
+		}
+		diff.Moved = append(diff.Moved, pairMoves(only(oldImages, newImages), only(newImages, oldImages))...)
+	}
+	slices.SortFunc(diff.Moved, func(a, b MovedContainer) int {
+		return cmp.Or(
+			compareContainersByLocation(a.Container, b.Container),
+			cmp.Compare(a.From, b.From),
+			cmp.Compare(a.To, b.To),
+		)
+	})
+
+	return diff
+}
+
+func imagesByReference(m discovery.Manifest) map[string]discovery.DiscoveredImage {
+	images := make(map[string]discovery.DiscoveredImage, len(m.DiscoveredImages))
+	for _, image := range m.DiscoveredImages {
+		images[imageref.Normalize(image.Image)] = image
+	}
+
+	return images
+}
+
+// movedKey identifies a container across discovery runs, in which its pod may
+// be named differently.
+type movedKey struct {
+	Namespace    string
+	Name         string
+	Type         string
+	ReferencedBy string
+}
+
+// containerUse is an image used by a container, and the first container found
+// using it.
+type containerUse struct {
+	image     string
+	container discovery.DiscoveredContainer
+}
+
+// containerUses returns the images used by each container in m, by their
+// normalized reference.
+func containerUses(m discovery.Manifest) map[movedKey]map[string]containerUse {
+	uses := map[movedKey]map[string]containerUse{}
+	for _, image := range m.DiscoveredImages {
+		ref := imageref.Normalize(image.Image)
+		for _, c := range image.Containers {
+			key := movedKey{Namespace: c.Pod.Namespace, Name: c.Name, Type: c.Type, ReferencedBy: c.ReferencedBy}
+			if uses[key] == nil {
+				uses[key] = map[string]containerUse{}
+			}
+			if _, found := uses[key][ref]; !found {
+				uses[key][ref] = containerUse{image: image.Image, container: c}
+			}
+		}
+	}
+
+	return uses
+}
+
+// only returns the uses in uses whose image is not in other, ordered by image.
+func only(uses, other map[string]containerUse) []containerUse {
+	var found []containerUse
+	for ref, use := range uses {
+		if _, inOther := other[ref]; !inOther {
+			found = append(found, use)
+		}
+	}
+	slices.SortFunc(found, func(a, b containerUse) int {
+		return cmp.Compare(a.image, b.image)
+	})
+
+	return found
+}
+
+// pairMoves pairs each image in from with at most one image in to, both used
+// by containers of the same namespace, name and type. Several workloads of a
+// namespace may name their containers alike, so the pods whose names share the
+// longest prefix, i.e. are most likely of the same workload, are paired first.
+func pairMoves(from, to []containerUse) []MovedContainer {
+	type candidate struct {
+		from, to, shared int
+	}
+	var candidates []candidate
+	for i := range from {
+		for j := range to {
+			shared := commonPrefixLength(from[i].container.Pod.Name, to[j].container.Pod.Name)
+			candidates = append(candidates, candidate{from: i, to: j, shared: shared})
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return cmp.Compare(b.shared, a.shared)
+	})
+
+	var moved []MovedContainer
+	pairedFrom, pairedTo := map[int]bool{}, map[int]bool{}
+	for _, c := range candidates {
+		if pairedFrom[c.from] || pairedTo[c.to] {
+			continue
+		}
+		pairedFrom[c.from], pairedTo[c.to] = true, true
+		moved = append(moved, MovedContainer{Container: from[c.from].container, From: from[c.from].image, To: to[c.to].image})
+	}
+
+	return moved
+}
+
+func commonPrefixLength(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+
+	return n
+}
+
+// repositoryOf returns the fully qualified repository of image, or image
+// itself if it cannot be parsed.
+func repositoryOf(image string) string {
+	ref, err := imageref.Parse(image)
+	if err != nil {
+		return image
+	}
+
+	return ref.Name()
+}
+
+func imageNames(images []discovery.DiscoveredImage) []string {
+	names := make([]string, 0, len(images))
+	for _, image := range images {
+		names = append(names, image.Image)
+	}
+
+	return names
+}
+
+// WriteManifestDiff writes diff to out in the requested format.
+func WriteManifestDiff(out io.Writer, diff ManifestDiff, format DiffFormat) error {
+	switch format {
+	case DiffFormatText:
+		return writeDiffText(out, diff)
+	case DiffFormatJSON:
+		diffJSON, err := json.MarshalIndent(diff, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(diffJSON))
+		return err
+	case DiffFormatMarkdown:
+		return writeDiffMarkdown(out, diff)
+	default:
+		return fmt.Errorf("unsupported diff format %q, must be one of %v", format, DiffFormats)
+	}
+}
+
+func writeDiffText(out io.Writer, diff ManifestDiff) error {
+	if !diff.HasDifferences() {
+		_, err := fmt.Fprintln(out, "no differences found")
+		return err
+	}
+
+	b := &strings.Builder{}
+	for _, image := range diff.Added {
+		fmt.Fprintf(b, "+ %s\n", image.Image)
+	}
+	for _, image := range diff.Removed {
+		fmt.Fprintf(b, "- %s\n", image.Image)
+	}
+	for _, changed := range diff.Changed {
+		fmt.Fprintf(b, "~ %s: %s -> %s\n", changed.Repository, strings.Join(changed.From, ", "), strings.Join(changed.To, ", "))
+	}
+	for _, moved := range diff.Moved {
+		fmt.Fprintf(b, "> %s: %s -> %s\n", describeContainer(moved.Container), moved.From, moved.To)
+	}
+
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+func writeDiffMarkdown(out io.Writer, diff ManifestDiff) error {
+	b := &strings.Builder{}
+	fmt.Fprintln(b, "# Manifest differences")
+	if !diff.HasDifferences() {
+		fmt.Fprintln(b, "\nNo differences found.")
+		_, err := io.WriteString(out, b.String())
+		return err
+	}
+
+	if len(diff.Added) > 0 {
+		fmt.Fprint(b, "\n## Added images\n\n")
+		for _, image := range diff.Added {
+			fmt.Fprintf(b, "- `%s`\n", image.Image)
+		}
+	}
+	if len(diff.Removed) > 0 {
+		fmt.Fprint(b, "\n## Removed images\n\n")
+		for _, image := range diff.Removed {
+			fmt.Fprintf(b, "- `%s`\n", image.Image)
+		}
+	}
+	if len(diff.Changed) > 0 {
+		fmt.Fprint(b, "\n## Changed images\n\n")
+		fmt.Fprintln(b, "| Repository | From | To |")
+		fmt.Fprintln(b, "| --- | --- | --- |")
+		for _, changed := range diff.Changed {
+			fmt.Fprintf(b, "| `%s` | %s | %s |\n", changed.Repository, markdownCodeList(changed.From), markdownCodeList(changed.To))
+		}
+	}
+	if len(diff.Moved) > 0 {
+		fmt.Fprint(b, "\n## Moved containers\n\n")
+		fmt.Fprintln(b, "| Container | From | To |")
+		fmt.Fprintln(b, "| --- | --- | --- |")
+		for _, moved := range diff.Moved {
+			fmt.Fprintf(b, "| %s | `%s` | `%s` |\n", describeContainer(moved.Container), moved.From, moved.To)
+		}
+	}
+
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// describeContainer returns a human readable location of c, in the form
+// namespace/pod/container (type).
+func describeContainer(c discovery.DiscoveredContainer) string {
+	return fmt.Sprintf("%s/%s/%s (%s)", c.Pod.Namespace, c.Pod.Name, c.Name, c.Type)
+}
+
+func markdownCodeList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, "`"+v+"`")
+	}
+
+	return strings.Join(quoted, "<br>")
+}
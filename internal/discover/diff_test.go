@@ -0,0 +1,231 @@
+package discover
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func TestDiffManifests(t *testing.T) {
+	t.Parallel()
+	operator := discovery.DiscoveredContainer{
+		Name: "manager",
+		Type: discovery.ContainerTypeStandard,
+		Pod:  discovery.DiscoveredPod{Name: "operator", Namespace: "ns"},
+	}
+	proxy := discovery.DiscoveredContainer{
+		Name: "proxy",
+		Type: discovery.ContainerTypeStandard,
+		Pod:  discovery.DiscoveredPod{Name: "operator", Namespace: "ns"},
+	}
+	oldManifest := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{Image: "example.com/org/operator:1.0", Containers: []discovery.DiscoveredContainer{operator}},
+			{Image: "example.com/org/proxy:1.0", Containers: []discovery.DiscoveredContainer{proxy}},
+			{Image: "example.com/org/removed:1.0"},
+			{Image: "nginx"},
+		},
+	}
+	newManifest := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{Image: "docker.io/library/nginx:latest"},
+			{Image: "example.com/org/added:1.0"},
+			{Image: "example.com/org/operator:1.1", Containers: []discovery.DiscoveredContainer{operator}},
+			{Image: "example.com/org/proxy:1.0", Containers: []discovery.DiscoveredContainer{proxy}},
+		},
+	}
+
+	diff := DiffManifests(oldManifest, newManifest)
+	if !diff.HasDifferences() {
+		t.Fatalf("DiffManifests did not find any differences")
+	}
+
+	if len(diff.Added) != 1 || diff.Added[0].Image != "example.com/org/added:1.0" {
+		t.Errorf("DiffManifests returned added images %v", diff.Added)
+	}
+
+	if len(diff.Removed) != 1 || diff.Removed[0].Image != "example.com/org/removed:1.0" {
+		t.Errorf("DiffManifests returned removed images %v", diff.Removed)
+	}
+
+	expectedChange := ChangedImage{
+		Repository: "example.com/org/operator",
+		From:       []string{"example.com/org/operator:1.0"},
+		To:         []string{"example.com/org/operator:1.1"},
+	}
+	if len(diff.Changed) != 1 ||
+		diff.Changed[0].Repository != expectedChange.Repository ||
+		!slices.Equal(diff.Changed[0].From, expectedChange.From) ||
+		!slices.Equal(diff.Changed[0].To, expectedChange.To) {
+		t.Errorf("DiffManifests returned changed images %v; expected %v", diff.Changed, expectedChange)
+	}
+
+	expectedMove := MovedContainer{Container: operator, From: "example.com/org/operator:1.0", To: "example.com/org/operator:1.1"}
+	if len(diff.Moved) != 1 ||
+		!containersEqual(diff.Moved[0].Container, expectedMove.Container) ||
+		diff.Moved[0].From != expectedMove.From ||
+		diff.Moved[0].To != expectedMove.To {
+		t.Errorf("DiffManifests returned moved containers %v; expected %v", diff.Moved, expectedMove)
+	}
+}
+
+func TestDiffManifestsRecreatedPods(t *testing.T) {
+	t.Parallel()
+	oldOperator := discovery.DiscoveredContainer{
+		Name: "manager",
+		Type: discovery.ContainerTypeStandard,
+		Pod:  discovery.DiscoveredPod{Name: "operator-7d4b9c-x2x7k", Namespace: "ns"},
+	}
+	newOperator := oldOperator
+	newOperator.Pod.Name = "operator-5f6d8b-q9zlw"
+	otherNamespace := newOperator
+	otherNamespace.Pod.Namespace = "other"
+
+	oldManifest := discovery.Manifest{DiscoveredImages: []discovery.DiscoveredImage{
+		{Image: "example.com/org/operator:1.0", Containers: []discovery.DiscoveredContainer{oldOperator}},
+	}}
+	newManifest := discovery.Manifest{DiscoveredImages: []discovery.DiscoveredImage{
+		{Image: "example.com/org/operator:1.1", Containers: []discovery.DiscoveredContainer{newOperator}},
+		{Image: "example.com/org/operator:2.0", Containers: []discovery.DiscoveredContainer{otherNamespace}},
+	}}
+
+	diff := DiffManifests(oldManifest, newManifest)
+	if len(diff.Moved) != 1 ||
+		!containersEqual(diff.Moved[0].Container, oldOperator) ||
+		diff.Moved[0].From != "example.com/org/operator:1.0" ||
+		diff.Moved[0].To != "example.com/org/operator:1.1" {
+		t.Errorf("DiffManifests returned moved containers %v; expected the manager container to move to 1.1", diff.Moved)
+	}
+}
+
+func TestDiffManifestsPairsMoves(t *testing.T) {
+	t.Parallel()
+	container := func(name, pod string) discovery.DiscoveredContainer {
+		return discovery.DiscoveredContainer{
+			Name: name,
+			Type: discovery.ContainerTypeStandard,
+			Pod:  discovery.DiscoveredPod{Name: pod, Namespace: "ns"},
+		}
+	}
+
+	testcases := map[string]struct {
+		oldImages map[string]discovery.DiscoveredContainer
+		newImages map[string]discovery.DiscoveredContainer
+		expected  []MovedContainer
+	}{
+		"two containers of one pod": {
+			oldImages: map[string]discovery.DiscoveredContainer{
+				"example.com/org/app:1.0":   container("app", "app-7d4b9c-x2x7k"),
+				"example.com/org/proxy:1.0": container("proxy", "app-7d4b9c-x2x7k"),
+			},
+			newImages: map[string]discovery.DiscoveredContainer{
+				"example.com/org/app:1.1":   container("app", "app-5f6d8b-q9zlw"),
+				"example.com/org/proxy:1.1": container("proxy", "app-5f6d8b-q9zlw"),
+			},
+			expected: []MovedContainer{
+				{Container: container("app", "app-7d4b9c-x2x7k"), From: "example.com/org/app:1.0", To: "example.com/org/app:1.1"},
+				{Container: container("proxy", "app-7d4b9c-x2x7k"), From: "example.com/org/proxy:1.0", To: "example.com/org/proxy:1.1"},
+			},
+		},
+		"alike containers of two workloads": {
+			oldImages: map[string]discovery.DiscoveredContainer{
+				"example.com/org/backup-operator:1.0": container("manager", "backup-operator-7d4b9c-x2x7k"),
+				"example.com/org/cache-operator:1.0":  container("manager", "cache-operator-6c8f4d-r8pkw"),
+			},
+			newImages: map[string]discovery.DiscoveredContainer{
+				"example.com/org/backup-operator:1.1": container("manager", "backup-operator-5f6d8b-q9zlw"),
+				"example.com/org/cache-operator:1.1":  container("manager", "cache-operator-9b7c5e-m4tjd"),
+			},
+			expected: []MovedContainer{
+				{Container: container("manager", "backup-operator-7d4b9c-x2x7k"), From: "example.com/org/backup-operator:1.0", To: "example.com/org/backup-operator:1.1"},
+				{Container: container("manager", "cache-operator-6c8f4d-r8pkw"), From: "example.com/org/cache-operator:1.0", To: "example.com/org/cache-operator:1.1"},
+			},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			oldManifest, newManifest := discovery.Manifest{}, discovery.Manifest{}
+			for image, c := range tc.oldImages {
+				oldManifest.DiscoveredImages = append(oldManifest.DiscoveredImages, discovery.DiscoveredImage{Image: image, Containers: []discovery.DiscoveredContainer{c}})
+			}
+			for image, c := range tc.newImages {
+				newManifest.DiscoveredImages = append(newManifest.DiscoveredImages, discovery.DiscoveredImage{Image: image, Containers: []discovery.DiscoveredContainer{c}})
+			}
+
+			diff := DiffManifests(oldManifest, newManifest)
+			if !slices.EqualFunc(diff.Moved, tc.expected, func(a, b MovedContainer) bool {
+				return containersEqual(a.Container, b.Container) && a.From == b.From && a.To == b.To
+			}) {
+				t.Fatalf("DiffManifests returned moved containers %v; expected %v", diff.Moved, tc.expected)
+			}
+		})
+	}
+}
+
+func TestDiffManifestsEquivalent(t *testing.T) {
+	t.Parallel()
+	m := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{Image: "example.com/org/a:1"},
+			{Image: "example.com/org/b:1"},
+		},
+	}
+	reordered := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{m.DiscoveredImages[1], m.DiscoveredImages[0]},
+	}
+
+	if diff := DiffManifests(m, reordered); diff.HasDifferences() {
+		t.Fatalf("DiffManifests found differences in reordered manifests: %v", diff)
+	}
+}
+
+func TestWriteManifestDiff(t *testing.T) {
+	t.Parallel()
+	diff := ManifestDiff{
+		Added:   []discovery.DiscoveredImage{{Image: "example.com/org/added:1.0"}},
+		Changed: []ChangedImage{{Repository: "example.com/org/op", From: []string{"example.com/org/op:1"}, To: []string{"example.com/org/op:2"}}},
+	}
+
+	testcases := map[string]struct {
+		format   DiffFormat
+		expected []string
+	}{
+		"text": {
+			format:   DiffFormatText,
+			expected: []string{"+ example.com/org/added:1.0\n", "~ example.com/org/op: example.com/org/op:1 -> example.com/org/op:2\n"},
+		},
+		"json": {
+			format:   DiffFormatJSON,
+			expected: []string{`"Repository": "example.com/org/op"`, `"Image": "example.com/org/added:1.0"`},
+		},
+		"markdown": {
+			format:   DiffFormatMarkdown,
+			expected: []string{"## Added images\n\n- `example.com/org/added:1.0`\n", "| `example.com/org/op` | `example.com/org/op:1` | `example.com/org/op:2` |\n"},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			buffer := &bytes.Buffer{}
+			if err := WriteManifestDiff(buffer, diff, tc.format); err != nil {
+				t.Fatalf("WriteManifestDiff returned an unexpected error: %q", err)
+			}
+
+			for _, want := range tc.expected {
+				if !strings.Contains(buffer.String(), want) {
+					t.Errorf("WriteManifestDiff output did not contain %q:\n%s", want, buffer.String())
+				}
+			}
+		})
+	}
+
+	if err := WriteManifestDiff(&bytes.Buffer{}, diff, "bogus"); err == nil {
+		t.Fatalf("WriteManifestDiff accepted an unsupported format")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
+	k8sdiscovery "k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -16,14 +18,17 @@ import (
 // to handle found workloads
 type ProcessingFunction func(ctx context.Context, source <-chan *corev1.Pod, logger *slog.Logger) error
 
-// WatchForWorkloads
+// WatchForWorkloads watches namespaces for created pods matching listOptions,
+// and sends them to processorFn. If journal is not nil, every watch event is
+// recorded in it.
 func WatchForWorkloads(
 	ctx context.Context,
 	logger *slog.Logger,
 	namespaces []string,
 	listOptions metav1.ListOptions,
-	k8sclient *kubernetes.Clientset,
+	k8sclient kubernetes.Interface,
 	processorFn ProcessingFunction,
+	journal *Journal,
 ) error {
 	podProcessing := make(chan *corev1.Pod)
 	var wg sync.WaitGroup
@@ -41,7 +46,7 @@ func WatchForWorkloads(
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err := MonitorCreatedPods(ctx, logger.With("namespace", ns), ns, podProcessing, k8sclient, listOptions)
+			err := MonitorCreatedPods(ctx, logger.With("namespace", ns), ns, podProcessing, k8sclient, listOptions, journal)
 			if err != nil {
 				logger.Error("pod monitor failed", "errMsg", err)
 			}
@@ -70,14 +75,16 @@ func WatchForWorkloads(
 }
 
 // MonitorCreatedPods checks for pods created in namespace inNS matching options
-// listOptions, and sends the object to sendTo for processing.
+// listOptions, and sends the object to sendTo for processing. If journal is not
+// nil, every event received is recorded in it.
 func MonitorCreatedPods(
 	ctx context.Context,
 	logger *slog.Logger,
 	inNS string,
 	sendTo chan *corev1.Pod,
-	clientset *kubernetes.Clientset,
+	clientset kubernetes.Interface,
 	listOptions metav1.ListOptions,
+	journal *Journal,
 ) error {
 	logger.Debug("generating a kubernetes watcher")
 	watcher, err := clientset.CoreV1().Pods(inNS).Watch(ctx, listOptions)
@@ -95,6 +102,11 @@ func MonitorCreatedPods(
 				logger.Debug("pod monitoring completed because the watch channel closed.")
 				return nil
 			}
+			if journal != nil {
+				if err := journal.Record(inNS, event); err != nil {
+					logger.Error("failed to record watch event", "errMsg", err)
+				}
+			}
 			if event.Type == watch.Added {
 				item := event.Object.(*corev1.Pod)
 				sendTo <- item
@@ -122,3 +134,37 @@ func InitializeKubernetesClient(kubeconfigPath string) (*kubernetes.Clientset, e
 
 	return clientset, nil
 }
+
+// InitializeDiscoveryClient uses the kubeconfigPath provided to establish a
+// client for the API discovery endpoints, which describe the resources served
+// by the cluster.
+func InitializeDiscoveryClient(kubeconfigPath string) (k8sdiscovery.DiscoveryInterface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := k8sdiscovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// InitializeDynamicClient uses the kubeconfigPath provided to establish a
+// dynamic client, for resources which have no typed client, such as those
+// provided by OLM or OpenShift.
+func InitializeDynamicClient(kubeconfigPath string) (dynamic.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
@@ -0,0 +1,72 @@
+package discover
+
+import (
+	"log/slog"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+// DefaultEnvImagePattern matches the environment variables which operators
+// conventionally use to advertise the images of their operands.
+const DefaultEnvImagePattern = "^RELATED_IMAGE_"
+
+// envReferencePrefix prefixes the ReferencedBy value of images found in
+// environment variables.
+const envReferencePrefix = "env:"
+
+// processEnvReferences produces DiscoveredImages for the environment variables
+// of each container in the pod whose name matches pattern, and whose value is
+// an image reference. Only literal values are considered.
+func processEnvReferences(
+	p *corev1.Pod,
+	pattern *regexp.Regexp,
+	logger *slog.Logger,
+) []discovery.DiscoveredImage {
+	var found []discovery.DiscoveredImage
+	collect := func(containerName string, containerType discovery.ContainerType, env []corev1.EnvVar) {
+		for _, e := range env {
+			if e.Value == "" || !pattern.MatchString(e.Name) {
+				continue
+			}
+			if _, err := imageref.Parse(e.Value); err != nil {
+				logger.Debug("ignoring environment variable that is not an image reference", "name", e.Name, "container", containerName, "pod", p.Name, "errMsg", err)
+				continue
+			}
+
+			logger.Debug("found a referenced image", "name", e.Name, "container", containerName, "pod", p.Name, "image", e.Value)
+			found = append(
+				found,
+				discovery.DiscoveredImage{
+					Image: e.Value,
+					Containers: []discovery.DiscoveredContainer{
+						{
+							Name:         containerName,
+							Type:         containerType,
+							ReferencedBy: envReferencePrefix + e.Name,
+							Pod: discovery.DiscoveredPod{
+								Name:      p.Name,
+								Namespace: p.Namespace,
+							},
+						},
+					},
+				},
+			)
+		}
+	}
+
+	for _, c := range p.Spec.Containers {
+		collect(c.Name, discovery.ContainerTypeStandard, c.Env)
+	}
+	for _, c := range p.Spec.InitContainers {
+		collect(c.Name, initContainerType(c), c.Env)
+	}
+	for _, c := range p.Spec.EphemeralContainers {
+		collect(c.Name, discovery.ContainerTypeEphemeral, c.Env)
+	}
+
+	return found
+}
@@ -0,0 +1,151 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func TestProcessEnvReferences(t *testing.T) {
+	t.Parallel()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator", Namespace: "ns"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "manager",
+					Image: "example.com/org/operator:1",
+					Env: []corev1.EnvVar{
+						{Name: "RELATED_IMAGE_DB", Value: "example.com/org/db:1"},
+						{Name: "RELATED_IMAGE_EMPTY", Value: ""},
+						{Name: "RELATED_IMAGE_INVALID", Value: "not an image"},
+						{Name: "LOG_LEVEL", Value: "debug"},
+						{Name: "PROXY_IMAGE", Value: "example.com/org/proxy:1"},
+					},
+				},
+			},
+			InitContainers: []corev1.Container{
+				{
+					Name:  "setup",
+					Image: "example.com/org/setup:1",
+					Env: []corev1.EnvVar{
+						{Name: "RELATED_IMAGE_MIGRATE", Value: "example.com/org/migrate:1"},
+					},
+				},
+			},
+		},
+	}
+
+	testcases := map[string]struct {
+		pattern  string
+		expected []discovery.DiscoveredImage
+	}{
+		"related image convention": {
+			pattern: DefaultEnvImagePattern,
+			expected: []discovery.DiscoveredImage{
+				{
+					Image: "example.com/org/db:1",
+					Containers: []discovery.DiscoveredContainer{
+						{
+							Name:         "manager",
+							Type:         discovery.ContainerTypeStandard,
+							Pod:          discovery.DiscoveredPod{Name: "operator", Namespace: "ns"},
+							ReferencedBy: "env:RELATED_IMAGE_DB",
+						},
+					},
+				},
+				{
+					Image: "example.com/org/migrate:1",
+					Containers: []discovery.DiscoveredContainer{
+						{
+							Name:         "setup",
+							Type:         discovery.ContainerTypeInit,
+							Pod:          discovery.DiscoveredPod{Name: "operator", Namespace: "ns"},
+							ReferencedBy: "env:RELATED_IMAGE_MIGRATE",
+						},
+					},
+				},
+			},
+		},
+		"custom pattern": {
+			pattern: "_IMAGE$",
+			expected: []discovery.DiscoveredImage{
+				{
+					Image: "example.com/org/proxy:1",
+					Containers: []discovery.DiscoveredContainer{
+						{
+							Name:         "manager",
+							Type:         discovery.ContainerTypeStandard,
+							Pod:          discovery.DiscoveredPod{Name: "operator", Namespace: "ns"},
+							ReferencedBy: "env:PROXY_IMAGE",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			actual := processEnvReferences(pod, regexp.MustCompile(tc.pattern), NewSlogDiscardLogger())
+			if len(actual) != len(tc.expected) {
+				t.Fatalf("Processing returned %v; expected %v", actual, tc.expected)
+			}
+
+			for idx := range actual {
+				if !imagesEqual(actual[idx], tc.expected[idx]) {
+					t.Fatalf("Processing returned %v; expected %v", actual, tc.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestManifestJSONProcessorEnvReferences(t *testing.T) {
+	t.Parallel()
+	// The operator container both runs and references its own image, which
+	// must be recorded as two separate entries.
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator", Namespace: "ns"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "manager",
+					Image: "example.com/org/operator:1",
+					Env: []corev1.EnvVar{
+						{Name: "RELATED_IMAGE_OPERATOR", Value: "example.com/org/operator:1"},
+					},
+				},
+			},
+		},
+	}
+
+	buffer := &bytes.Buffer{}
+	fn := NewManifestJSONProcessorFn(buffer, NewManifestJSONProcessorFnOptions{
+		CompactOutput:   true,
+		EnvImagePattern: regexp.MustCompile(DefaultEnvImagePattern),
+	})
+	if err := ProcessPods(context.TODO(), NewSlogDiscardLogger(), []*corev1.Pod{pod}, fn); err != nil {
+		t.Fatalf("ProcessPods returned an unexpected error: %q", err)
+	}
+
+	m, err := ReadManifest(strings.NewReader(buffer.String()))
+	if err != nil {
+		t.Fatalf("unable to read the produced manifest: %q", err)
+	}
+
+	if len(m.DiscoveredImages) != 1 || len(m.DiscoveredImages[0].Containers) != 2 {
+		t.Fatalf("processor produced an unexpected manifest: %s", buffer.String())
+	}
+	if m.DiscoveredImages[0].Containers[0].IsReference() || !m.DiscoveredImages[0].Containers[1].IsReference() {
+		t.Fatalf("processor did not distinguish observed and referenced images: %s", buffer.String())
+	}
+}
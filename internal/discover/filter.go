@@ -0,0 +1,69 @@
+package discover
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+// ContainerTypes lists every discovery.ContainerType.
+var ContainerTypes = []discovery.ContainerType{
+	discovery.ContainerTypeStandard,
+	discovery.ContainerTypeInit,
+	discovery.ContainerTypeSidecar,
+	discovery.ContainerTypeEphemeral,
+	discovery.ContainerTypeImageVolume,
+}
+
+// ParseContainerTypes validates each of types as a discovery.ContainerType.
+func ParseContainerTypes(types []string) ([]discovery.ContainerType, error) {
+	for _, t := range types {
+		if !slices.Contains(ContainerTypes, t) {
+			return nil, fmt.Errorf("unsupported container type %q, must be one of %v", t, ContainerTypes)
+		}
+	}
+
+	return types, nil
+}
+
+// FilterContainerTypes returns a copy of m with only the containers whose type
+// is one of types. References, such as those found in environment variables or
+// custom resources, are kept whatever their type, since they are not run by
+// the container; use ExcludeReferences to remove them. Images left without
+// containers are removed.
+func FilterContainerTypes(m discovery.Manifest, types []discovery.ContainerType) discovery.Manifest {
+	return FilterContainers(m, func(c discovery.DiscoveredContainer) bool {
+		return c.IsReference() || c.Type == "" || slices.Contains(types, c.Type)
+	})
+}
+
+// ExcludeReferences returns a copy of m with only the containers which were
+// observed running their image.
+func ExcludeReferences(m discovery.Manifest) discovery.Manifest {
+	return FilterContainers(m, func(c discovery.DiscoveredContainer) bool {
+		return !c.IsReference()
+	})
+}
+
+// FilterContainers returns a copy of m with only the containers for which keep
+// returns true. Images left without containers are removed.
+func FilterContainers(m discovery.Manifest, keep func(discovery.DiscoveredContainer) bool) discovery.Manifest {
+	filtered := discovery.Manifest{}
+	for _, image := range m.DiscoveredImages {
+		var containers []discovery.DiscoveredContainer
+		for _, c := range image.Containers {
+			if keep(c) {
+				containers = append(containers, c)
+			}
+		}
+		if len(containers) == 0 {
+			continue
+		}
+
+		image.Containers = containers
+		filtered.DiscoveredImages = append(filtered.DiscoveredImages, image)
+	}
+
+	return filtered
+}
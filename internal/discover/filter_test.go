@@ -0,0 +1,118 @@
+package discover
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func TestFilterContainerTypes(t *testing.T) {
+	t.Parallel()
+	m := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{
+				Image: "example.com/namespace/app:0.0.1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "app", Type: discovery.ContainerTypeStandard},
+					{Name: "setup", Type: discovery.ContainerTypeInit},
+				},
+			},
+			{
+				Image: "example.com/namespace/proxy:0.0.1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "proxy", Type: discovery.ContainerTypeSidecar},
+				},
+			},
+			{
+				Image: "example.com/namespace/debug:0.0.1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "debug", Type: discovery.ContainerTypeEphemeral},
+				},
+			},
+			{
+				Image: "example.com/namespace/operand:0.0.1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "setup", Type: discovery.ContainerTypeInit, ReferencedBy: "env:RELATED_IMAGE_OPERAND"},
+				},
+			},
+			{
+				Image: "example.com/namespace/cache:0.0.1",
+				Containers: []discovery.DiscoveredContainer{
+					{Pod: discovery.DiscoveredPod{Name: "example"}, ReferencedBy: "cr:Memcached/example:.spec.image"},
+				},
+			},
+		},
+	}
+
+	expected := []discovery.DiscoveredImage{
+		{
+			Image:      "example.com/namespace/app:0.0.1",
+			Containers: []discovery.DiscoveredContainer{{Name: "app", Type: discovery.ContainerTypeStandard}},
+		},
+		{
+			Image:      "example.com/namespace/proxy:0.0.1",
+			Containers: []discovery.DiscoveredContainer{{Name: "proxy", Type: discovery.ContainerTypeSidecar}},
+		},
+		{
+			Image:      "example.com/namespace/operand:0.0.1",
+			Containers: []discovery.DiscoveredContainer{{Name: "setup", Type: discovery.ContainerTypeInit, ReferencedBy: "env:RELATED_IMAGE_OPERAND"}},
+		},
+		{
+			Image:      "example.com/namespace/cache:0.0.1",
+			Containers: []discovery.DiscoveredContainer{{Pod: discovery.DiscoveredPod{Name: "example"}, ReferencedBy: "cr:Memcached/example:.spec.image"}},
+		},
+	}
+
+	types := []discovery.ContainerType{discovery.ContainerTypeStandard, discovery.ContainerTypeSidecar}
+	actual := FilterContainerTypes(m, types)
+	if !slices.EqualFunc(actual.DiscoveredImages, expected, imagesEqual) {
+		t.Fatalf("FilterContainerTypes returned %v; expected %v", actual.DiscoveredImages, expected)
+	}
+	if len(m.DiscoveredImages[0].Containers) != 2 {
+		t.Fatalf("FilterContainerTypes modified its input: %v", m.DiscoveredImages[0].Containers)
+	}
+}
+
+func TestExcludeReferences(t *testing.T) {
+	t.Parallel()
+	m := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{
+				Image: "example.com/namespace/app:0.0.1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "app", Type: discovery.ContainerTypeStandard},
+					{Name: "app", Type: discovery.ContainerTypeStandard, ReferencedBy: "env:RELATED_IMAGE_APP"},
+				},
+			},
+			{
+				Image: "example.com/namespace/operand:0.0.1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "app", Type: discovery.ContainerTypeStandard, ReferencedBy: "env:RELATED_IMAGE_OPERAND"},
+				},
+			},
+		},
+	}
+
+	expected := []discovery.DiscoveredImage{
+		{
+			Image:      "example.com/namespace/app:0.0.1",
+			Containers: []discovery.DiscoveredContainer{{Name: "app", Type: discovery.ContainerTypeStandard}},
+		},
+	}
+
+	actual := ExcludeReferences(m)
+	if !slices.EqualFunc(actual.DiscoveredImages, expected, imagesEqual) {
+		t.Fatalf("ExcludeReferences returned %v; expected %v", actual.DiscoveredImages, expected)
+	}
+}
+
+func TestParseContainerTypes(t *testing.T) {
+	t.Parallel()
+	if _, err := ParseContainerTypes([]string{discovery.ContainerTypeSidecar}); err != nil {
+		t.Fatalf("ParseContainerTypes returned an unexpected error: %q", err)
+	}
+	if _, err := ParseContainerTypes([]string{"Sidecar"}); err == nil {
+		t.Fatal("ParseContainerTypes accepted an unknown container type")
+	}
+}
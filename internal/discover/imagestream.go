@@ -0,0 +1,20 @@
+package discover
+
+import (
+	"context"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+// ImageStreamResolver returns the OpenShift ImageStream tag or image which
+// image refers to, and the external image it was imported from. Both are empty
+// if image is not in the internal registry.
+type ImageStreamResolver func(ctx context.Context, image string) (stream, source string)
+
+// withImageStreams records the ImageStream and source image of every image in
+// images which resolve resolves.
+func withImageStreams(ctx context.Context, images []discovery.DiscoveredImage, resolve ImageStreamResolver) {
+	for i := range images {
+		images[i].ImageStream, images[i].SourceImage = resolve(ctx, images[i].Image)
+	}
+}
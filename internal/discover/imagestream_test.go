@@ -0,0 +1,86 @@
+package discover
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+const (
+	testInternalImage = "image-registry.openshift-image-registry.svc:5000/ns/app@sha256:0123"
+	testStreamSource  = "quay.io/org/app:1"
+)
+
+// testImageStreams resolves testInternalImage, which was imported from
+// testStreamSource.
+func testImageStreams(_ context.Context, image string) (string, string) {
+	if image == testInternalImage {
+		return "ns/app:1", testStreamSource
+	}
+
+	return "", ""
+}
+
+// processPods runs the processor with opts on pods, and returns the manifest
+// it writes.
+func processPods(t *testing.T, pods []*corev1.Pod, opts NewManifestJSONProcessorFnOptions) discovery.Manifest {
+	t.Helper()
+	source := make(chan *corev1.Pod, len(pods))
+	for _, p := range pods {
+		source <- p
+	}
+	close(source)
+
+	var m discovery.Manifest
+	opts.Writer = func(_ io.Writer, found discovery.Manifest) error {
+		m = found
+		return nil
+	}
+	if err := NewManifestJSONProcessorFn(nil, opts)(context.TODO(), source, NewSlogDiscardLogger()); err != nil {
+		t.Fatalf("processorFn returned an unexpected error: %q", err)
+	}
+
+	return m
+}
+
+func TestImageStreams(t *testing.T) {
+	t.Parallel()
+	pods := []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "ns"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "app", Image: testInternalImage},
+					{Name: "db", Image: "quay.io/org/db:1"},
+				},
+			},
+		},
+	}
+
+	m := processPods(t, pods, NewManifestJSONProcessorFnOptions{ImageStreams: testImageStreams})
+
+	expected := map[string]struct {
+		stream string
+		source string
+	}{
+		testInternalImage:  {stream: "ns/app:1", source: testStreamSource},
+		"quay.io/org/db:1": {},
+	}
+	if len(m.DiscoveredImages) != len(expected) {
+		t.Fatalf("the processor returned %d images; expected %d", len(m.DiscoveredImages), len(expected))
+	}
+	for _, image := range m.DiscoveredImages {
+		want, found := expected[image.Image]
+		if !found {
+			t.Fatalf("the processor returned the unexpected image %s", image.Image)
+		}
+		if image.ImageStream != want.stream || image.SourceImage != want.source {
+			t.Errorf("image %s has ImageStream %q and SourceImage %q; expected %q and %q", image.Image, image.ImageStream, image.SourceImage, want.stream, want.source)
+		}
+	}
+}
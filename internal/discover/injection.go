@@ -0,0 +1,162 @@
+package discover
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+// InjectionRule identifies containers which an admission webhook or platform
+// injects into pods, such as service mesh proxies.
+type InjectionRule struct {
+	// Injector names what injected the container, e.g. "istio".
+	Injector string `json:"injector"`
+
+	// Containers are the names of the injected containers. Shell patterns,
+	// such as "vault-agent*", are supported.
+	Containers []string `json:"containers"`
+
+	// Annotations, if set, are annotation keys of which the pod must have at
+	// least one, e.g. the status annotation set by the injector.
+	Annotations []string `json:"annotations,omitempty"`
+
+	// Labels, if set, are label keys of which the pod must have at least one.
+	// When both Annotations and Labels are set, one of either is enough.
+	Labels []string `json:"labels,omitempty"`
+}
+
+// injectionRulesFile is the shape of a rules file read by
+// ReadInjectionRulesFile.
+type injectionRulesFile struct {
+	Rules []InjectionRule `json:"rules"`
+}
+
+// DefaultInjectionRules detect the containers injected by commonly used
+// service meshes and platform webhooks. Each rule requires the pod to carry
+// the injector's marker. OpenShift's kube-rbac-proxy has none, as it is part
+// of the workload's own pod template, so the README gives its rule as an
+// example for --injection-rules instead.
+var DefaultInjectionRules = []InjectionRule{
+	{
+		Injector:    "istio",
+		Containers:  []string{"istio-proxy", "istio-init", "istio-validation"},
+		Annotations: []string{"sidecar.istio.io/status"},
+	},
+	{
+		Injector:   "linkerd",
+		Containers: []string{"linkerd-proxy", "linkerd-init", "linkerd-network-validator"},
+		Labels:     []string{"linkerd.io/control-plane-ns"},
+	},
+	{
+		Injector:    "vault",
+		Containers:  []string{"vault-agent", "vault-agent-init"},
+		Annotations: []string{"vault.hashicorp.com/agent-inject-status"},
+	},
+}
+
+// ReadInjectionRulesFile decodes the YAML or JSON encoded injection rules
+// stored at path, in the form:
+//
+//	rules:
+//	- injector: my-webhook
+//	  containers: [my-agent]
+//	  annotations: [example.com/injected]
+func ReadInjectionRulesFile(rulesPath string) ([]InjectionRule, error) {
+	content, err := os.ReadFile(rulesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := injectionRulesFile{}
+	if err := yaml.UnmarshalStrict(content, &rules); err != nil {
+		return nil, fmt.Errorf("unable to decode injection rules %s: %w", rulesPath, err)
+	}
+
+	for idx, rule := range rules.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("injection rule %d in %s is invalid: %w", idx, rulesPath, err)
+		}
+	}
+
+	return rules.Rules, nil
+}
+
+func (r InjectionRule) validate() error {
+	if r.Injector == "" {
+		return errors.New("injector is required")
+	}
+	if len(r.Containers) == 0 {
+		return errors.New("at least one container is required")
+	}
+	for _, pattern := range r.Containers {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("container pattern %q is malformed: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// Matches reports whether the container named containerName in p was
+// injected according to r.
+func (r InjectionRule) Matches(p *corev1.Pod, containerName string) bool {
+	nameMatches := slices.ContainsFunc(r.Containers, func(pattern string) bool {
+		matched, _ := path.Match(pattern, containerName)
+		return matched
+	})
+	if !nameMatches {
+		return false
+	}
+
+	if len(r.Annotations) == 0 && len(r.Labels) == 0 {
+		return true
+	}
+
+	for _, key := range r.Annotations {
+		if _, found := p.Annotations[key]; found {
+			return true
+		}
+	}
+	for _, key := range r.Labels {
+		if _, found := p.Labels[key]; found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// markInjected records the injector of each container of images which one of
+// rules matches. Image volumes are never injected.
+func markInjected(images []discovery.DiscoveredImage, p *corev1.Pod, rules []InjectionRule) {
+	for i := range images {
+		for j := range images[i].Containers {
+			c := &images[i].Containers[j]
+			if c.Type == discovery.ContainerTypeImageVolume {
+				continue
+			}
+
+			for _, rule := range rules {
+				if rule.Matches(p, c.Name) {
+					c.InjectedBy = rule.Injector
+					break
+				}
+			}
+		}
+	}
+}
+
+// ExcludeInjected returns a copy of m without the containers which were
+// injected into their pods.
+func ExcludeInjected(m discovery.Manifest) discovery.Manifest {
+	return FilterContainers(m, func(c discovery.DiscoveredContainer) bool {
+		return c.InjectedBy == ""
+	})
+}
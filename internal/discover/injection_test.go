@@ -0,0 +1,104 @@
+package discover
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func TestMarkInjected(t *testing.T) {
+	t.Parallel()
+	rulesPath := filepath.Join(t.TempDir(), "rules.yaml")
+	rules := `rules:
+- injector: my-webhook
+  containers: ["agent-*"]
+  labels: [example.com/injected]
+- injector: kube-rbac-proxy
+  containers: ["kube-rbac-proxy*"]
+`
+	if err := os.WriteFile(rulesPath, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	custom, err := ReadInjectionRulesFile(rulesPath)
+	if err != nil {
+		t.Fatalf("ReadInjectionRulesFile returned an unexpected error: %q", err)
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "podname",
+			Annotations: map[string]string{"sidecar.istio.io/status": "{}"},
+			Labels:      map[string]string{"example.com/injected": "true"},
+		},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "istio-init", Image: "example.com/istio/proxyv2:1"}},
+			Containers: []corev1.Container{
+				{Name: "app", Image: "example.com/namespace/app:0.0.1"},
+				{Name: "istio-proxy", Image: "example.com/istio/proxyv2:1"},
+				{Name: "agent-logs", Image: "example.com/namespace/agent:0.0.1"},
+				{Name: "kube-rbac-proxy", Image: "example.com/openshift/kube-rbac-proxy:4"},
+			},
+		},
+	}
+
+	found := processContainers(pod, NewSlogDiscardLogger())
+	markInjected(found, pod, slices.Concat(custom, DefaultInjectionRules))
+
+	injectedBy := map[string]string{}
+	for _, image := range found {
+		for _, c := range image.Containers {
+			injectedBy[c.Name] = c.InjectedBy
+		}
+	}
+	expected := map[string]string{"app": "", "istio-proxy": "istio", "istio-init": "istio", "agent-logs": "my-webhook", "kube-rbac-proxy": "kube-rbac-proxy"}
+	for name, injector := range expected {
+		if injectedBy[name] != injector {
+			t.Errorf("container %s was marked as injected by %q; expected %q", name, injectedBy[name], injector)
+		}
+	}
+
+	m := ExcludeInjected(appendToManifest(discovery.Manifest{}, found...))
+	if len(m.DiscoveredImages) != 1 || m.DiscoveredImages[0].Image != "example.com/namespace/app:0.0.1" {
+		t.Fatalf("ExcludeInjected returned %v; expected only the app image", m.DiscoveredImages)
+	}
+}
+
+func TestInjectionRuleRequiresPodMetadata(t *testing.T) {
+	t.Parallel()
+	// Without the status annotation, a container named istio-proxy is part
+	// of the workload.
+	pod := &corev1.Pod{}
+	if DefaultInjectionRules[0].Matches(pod, "istio-proxy") {
+		t.Fatal("the istio rule matched a pod without the injection annotation")
+	}
+
+	// Every default rule requires the injector's marker, so that containers
+	// scaffolded into a workload, such as kube-rbac-proxy, are not marked.
+	for _, rule := range DefaultInjectionRules {
+		if len(rule.Annotations) == 0 && len(rule.Labels) == 0 {
+			t.Errorf("the default %s rule does not require an annotation or label", rule.Injector)
+		}
+		if rule.Matches(pod, "kube-rbac-proxy") {
+			t.Errorf("the default %s rule matched kube-rbac-proxy", rule.Injector)
+		}
+	}
+}
+
+func TestReadInjectionRulesFileRejectsInvalidRules(t *testing.T) {
+	t.Parallel()
+	rulesPath := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(rulesPath, []byte("rules:\n- injector: incomplete\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadInjectionRulesFile(rulesPath); err == nil {
+		t.Fatal("ReadInjectionRulesFile accepted a rule without containers")
+	}
+}
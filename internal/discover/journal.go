@@ -0,0 +1,132 @@
+package discover
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// JournalEntry is a single watch event recorded in a Journal.
+type JournalEntry struct {
+	// Time is when the event was received.
+	Time time.Time
+
+	// Namespace is the namespace that was being watched.
+	Namespace string
+
+	// Type is the type of the watch event, e.g. ADDED or DELETED.
+	Type watch.EventType
+
+	// Object is the JSON-encoded object of the event. This is usually a pod,
+	// but is a status for events of type ERROR.
+	Object json.RawMessage
+}
+
+// Journal records watch events as newline-delimited JSON, so that discovery
+// runs can later be replayed. It is safe for concurrent use.
+type Journal struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	now func() time.Time
+}
+
+// NewJournal returns a Journal which writes entries to out.
+func NewJournal(out io.Writer) *Journal {
+	return &Journal{
+		enc: json.NewEncoder(out),
+		now: time.Now,
+	}
+}
+
+// Record writes event, received while watching namespace, to the journal.
+func (j *Journal) Record(namespace string, event watch.Event) error {
+	object, err := json.Marshal(event.Object)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.enc.Encode(JournalEntry{
+		Time:      j.now().UTC(),
+		Namespace: namespace,
+		Type:      event.Type,
+		Object:    object,
+	})
+}
+
+// ReadJournal decodes all entries recorded in a journal.
+func ReadJournal(r io.Reader) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(r)
+	// Pods can easily exceed the default token size.
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		entry := JournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("unable to decode journal entry on line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// PodsFromJournal returns the pods of the ADDED events in entries, which are
+// the events that are processed while watching a cluster.
+func PodsFromJournal(entries []JournalEntry) ([]*corev1.Pod, error) {
+	var pods []*corev1.Pod
+	for _, entry := range entries {
+		if entry.Type != watch.Added {
+			continue
+		}
+
+		p := &corev1.Pod{}
+		if err := json.Unmarshal(entry.Object, p); err != nil {
+			return nil, fmt.Errorf("unable to decode pod recorded at %s: %w", entry.Time, err)
+		}
+		pods = append(pods, p)
+	}
+
+	return pods, nil
+}
+
+// ReplayJournal sends the pods recorded in the journal read from r through
+// processorFn, as if they were discovered by watching a cluster.
+func ReplayJournal(
+	ctx context.Context,
+	logger *slog.Logger,
+	r io.Reader,
+	processorFn ProcessingFunction,
+) error {
+	entries, err := ReadJournal(r)
+	if err != nil {
+		return err
+	}
+
+	pods, err := PodsFromJournal(entries)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("replaying journal", "entries", len(entries), "pods", len(pods))
+	return ProcessPods(ctx, logger, pods, processorFn)
+}
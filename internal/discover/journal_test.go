@@ -0,0 +1,109 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestMonitorCreatedPodsRecordsJournal(t *testing.T) {
+	t.Parallel()
+	fakeWatcher := watch.NewFake()
+	clientset := fake.NewClientset()
+	clientset.PrependWatchReactor("pods", k8stesting.DefaultWatchReactor(fakeWatcher, nil))
+
+	journalBuffer := &bytes.Buffer{}
+	journal := NewJournal(journalBuffer)
+	sendTo := make(chan *corev1.Pod)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var monitorErr error
+	go func() {
+		defer wg.Done()
+		monitorErr = MonitorCreatedPods(context.TODO(), NewSlogDiscardLogger(), "ns", sendTo, clientset, metav1.ListOptions{}, journal)
+	}()
+
+	added := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "ns"},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "cname", Image: "example.com/namespace/image:0.0.1"}},
+		},
+	}
+
+	go func() {
+		fakeWatcher.Add(added)
+		fakeWatcher.Modify(added)
+		fakeWatcher.Delete(added)
+		fakeWatcher.Stop()
+	}()
+
+	received := <-sendTo
+	wg.Wait()
+
+	if monitorErr != nil {
+		t.Fatalf("MonitorCreatedPods returned an unexpected error: %q", monitorErr)
+	}
+	if received.Name != added.Name {
+		t.Fatalf("MonitorCreatedPods sent pod %q; expected %q", received.Name, added.Name)
+	}
+
+	entries, err := ReadJournal(journalBuffer)
+	if err != nil {
+		t.Fatalf("ReadJournal returned an unexpected error: %q", err)
+	}
+
+	expectedTypes := []watch.EventType{watch.Added, watch.Modified, watch.Deleted}
+	if len(entries) != len(expectedTypes) {
+		t.Fatalf("journal recorded %d entries; expected %d", len(entries), len(expectedTypes))
+	}
+	for idx, entry := range entries {
+		if entry.Type != expectedTypes[idx] || entry.Namespace != "ns" || entry.Time.IsZero() {
+			t.Errorf("journal entry %d is unexpected: %+v", idx, entry)
+		}
+	}
+
+	pods, err := PodsFromJournal(entries)
+	if err != nil {
+		t.Fatalf("PodsFromJournal returned an unexpected error: %q", err)
+	}
+	if len(pods) != 1 || pods[0].Spec.Containers[0].Image != "example.com/namespace/image:0.0.1" {
+		t.Fatalf("PodsFromJournal returned unexpected pods: %v", pods)
+	}
+}
+
+func TestReplayJournal(t *testing.T) {
+	t.Parallel()
+	journal := strings.Join([]string{
+		`{"Time":"2024-01-01T00:00:00Z","Namespace":"ns","Type":"ADDED","Object":{"metadata":{"name":"pod-1","namespace":"ns"},"spec":{"containers":[{"name":"cname","image":"example.com/namespace/image:0.0.1"}]}}}`,
+		`{"Time":"2024-01-01T00:00:01Z","Namespace":"ns","Type":"DELETED","Object":{"metadata":{"name":"pod-1","namespace":"ns"},"spec":{"containers":[{"name":"cname","image":"example.com/namespace/image:0.0.1"}]}}}`,
+		`{"Time":"2024-01-01T00:00:02Z","Namespace":"ns","Type":"ERROR","Object":{"kind":"Status","message":"too old resource version"}}`,
+		"",
+	}, "\n")
+
+	buffer := &bytes.Buffer{}
+	fn := NewManifestJSONProcessorFn(buffer, NewManifestJSONProcessorFnOptions{CompactOutput: true})
+	if err := ReplayJournal(context.TODO(), NewSlogDiscardLogger(), strings.NewReader(journal), fn); err != nil {
+		t.Fatalf("ReplayJournal returned an unexpected error: %q", err)
+	}
+
+	expected := "{\"DiscoveredImages\":[{\"Image\":\"example.com/namespace/image:0.0.1\",\"Containers\":[{\"Name\":\"cname\",\"Type\":\"Container\",\"Pod\":{\"Name\":\"pod-1\",\"Namespace\":\"ns\"}}]}]}\n"
+	if buffer.String() != expected {
+		t.Fatalf("ReplayJournal produced %q; expected %q", buffer.String(), expected)
+	}
+}
+
+func TestReadJournalMalformed(t *testing.T) {
+	t.Parallel()
+	if _, err := ReadJournal(strings.NewReader("{}\nnot json\n")); err == nil {
+		t.Fatalf("ReadJournal accepted a malformed entry")
+	}
+}
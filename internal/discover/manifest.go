@@ -0,0 +1,65 @@
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+// ReadManifest decodes a JSON-encoded Manifest from r.
+func ReadManifest(r io.Reader) (discovery.Manifest, error) {
+	m := discovery.Manifest{}
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return discovery.Manifest{}, err
+	}
+
+	return m, nil
+}
+
+// ReadManifestFile decodes the JSON-encoded Manifest stored at path.
+func ReadManifestFile(path string) (discovery.Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return discovery.Manifest{}, err
+	}
+	defer f.Close()
+
+	m, err := ReadManifest(f)
+	if err != nil {
+		return discovery.Manifest{}, fmt.Errorf("unable to decode manifest %s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+// ManifestWriter writes a Manifest to out in a particular format.
+type ManifestWriter func(out io.Writer, m discovery.Manifest) error
+
+// NewJSONManifestWriter returns a ManifestWriter which encodes manifests as
+// JSON, either pretty-printed or compact.
+func NewJSONManifestWriter(compact bool) ManifestWriter {
+	return func(out io.Writer, m discovery.Manifest) error {
+		return WriteManifest(out, m, compact)
+	}
+}
+
+// WriteManifest encodes m as JSON to out, either pretty-printed or compact.
+func WriteManifest(out io.Writer, m discovery.Manifest, compact bool) error {
+	var manifestJSON []byte
+	var err error
+	if compact {
+		manifestJSON, err = json.Marshal(m)
+	} else {
+		manifestJSON, err = json.MarshalIndent(m, "", "    ")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, string(manifestJSON))
+	return err
+}
@@ -0,0 +1,45 @@
+package discover
+
+import (
+	"slices"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+// MergeManifests combines manifests into a single Manifest, using the same
+// rules applied while discovering workloads: images are deduplicated by
+// reference, and containers by name, type, pod, where they reference the image
+// (ReferencedBy) and platform. The sources recorded for a container are
+// combined when it is found in more than one manifest, and the platforms
+// required by each image are summarized again.
+func MergeManifests(manifests ...discovery.Manifest) discovery.Manifest {
+	merged := discovery.Manifest{}
+	for _, m := range manifests {
+		merged = appendToManifest(merged, m.DiscoveredImages...)
+	}
+
+	return SummarizePlatforms(merged)
+}
+
+// WithSource returns a copy of m in which every container that does not
+// already record a source is attributed to source.
+func WithSource(m discovery.Manifest, source string) discovery.Manifest {
+	attributed := discovery.Manifest{
+		DiscoveredImages: make([]discovery.DiscoveredImage, 0, len(m.DiscoveredImages)),
+	}
+	for _, image := range m.DiscoveredImages {
+		containers := make([]discovery.DiscoveredContainer, 0, len(image.Containers))
+		for _, c := range image.Containers {
+			if len(c.Sources) == 0 {
+				c.Sources = []string{source}
+			} else {
+				c.Sources = slices.Clone(c.Sources)
+			}
+			containers = append(containers, c)
+		}
+		image.Containers = containers
+		attributed.DiscoveredImages = append(attributed.DiscoveredImages, image)
+	}
+
+	return attributed
+}
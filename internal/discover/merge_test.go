@@ -0,0 +1,119 @@
+package discover
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func TestMergeManifests(t *testing.T) {
+	t.Parallel()
+	shared := discovery.DiscoveredContainer{
+		Name: "manager",
+		Type: discovery.ContainerTypeStandard,
+		Pod:  discovery.DiscoveredPod{Name: "operator", Namespace: "ns"},
+	}
+	arm := discovery.DiscoveredContainer{
+		Name: "optional",
+		Type: discovery.ContainerTypeStandard,
+		Pod:  discovery.DiscoveredPod{Name: "component", Namespace: "ns"},
+	}
+
+	x86 := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{Image: "example.com/org/operator:1", Containers: []discovery.DiscoveredContainer{shared}},
+		},
+	}
+	arm64 := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{Image: "example.com/org/operator:1", Containers: []discovery.DiscoveredContainer{shared}},
+			{Image: "example.com/org/optional:1", Containers: []discovery.DiscoveredContainer{arm}},
+		},
+	}
+
+	actual := MergeManifests(WithSource(x86, "x86_64"), WithSource(arm64, "arm64"))
+	expected := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{
+				Image: "example.com/org/operator:1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: shared.Name, Type: shared.Type, Pod: shared.Pod, Sources: []string{"x86_64", "arm64"}},
+				},
+			},
+			{
+				Image: "example.com/org/optional:1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: arm.Name, Type: arm.Type, Pod: arm.Pod, Sources: []string{"arm64"}},
+				},
+			},
+		},
+	}
+
+	if len(actual.DiscoveredImages) != len(expected.DiscoveredImages) {
+		t.Fatalf("MergeManifests returned %v; expected %v", actual, expected)
+	}
+	for idx := range actual.DiscoveredImages {
+		if !imagesEqual(actual.DiscoveredImages[idx], expected.DiscoveredImages[idx]) {
+			t.Fatalf("MergeManifests returned %v; expected %v", actual, expected)
+		}
+	}
+
+	// Inputs must be left untouched.
+	if len(x86.DiscoveredImages[0].Containers[0].Sources) != 0 {
+		t.Fatalf("MergeManifests modified its input: %v", x86)
+	}
+}
+
+func TestMergeManifestsKeepsPlatforms(t *testing.T) {
+	t.Parallel()
+	manager := discovery.DiscoveredContainer{
+		Name: "manager",
+		Type: discovery.ContainerTypeStandard,
+		Pod:  discovery.DiscoveredPod{Name: "operator", Namespace: "ns"},
+	}
+	amd64, arm64 := manager, manager
+	amd64.Platform = "linux/amd64"
+	arm64.Platform = "linux/arm64"
+
+	actual := MergeManifests(
+		WithSource(discovery.Manifest{DiscoveredImages: []discovery.DiscoveredImage{{Image: "example.com/org/operator:1", Containers: []discovery.DiscoveredContainer{amd64}}}}, "x86_64"),
+		WithSource(discovery.Manifest{DiscoveredImages: []discovery.DiscoveredImage{{Image: "example.com/org/operator:1", Containers: []discovery.DiscoveredContainer{arm64}}}}, "arm64"),
+	)
+
+	if len(actual.DiscoveredImages) != 1 {
+		t.Fatalf("MergeManifests returned %v; expected a single image", actual)
+	}
+	image := actual.DiscoveredImages[0]
+	expected := []string{"linux/amd64", "linux/arm64"}
+	if !slices.Equal(image.RequiredPlatforms, expected) {
+		t.Fatalf("MergeManifests returned required platforms %v; expected %v", image.RequiredPlatforms, expected)
+	}
+	if len(image.Containers) != 2 || image.Containers[0].Platform != "linux/amd64" || image.Containers[1].Platform != "linux/arm64" {
+		t.Fatalf("MergeManifests returned containers %+v; expected one for each platform", image.Containers)
+	}
+}
+
+func TestWithSourceKeepsExistingSources(t *testing.T) {
+	t.Parallel()
+	m := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{
+				Image: "example.com/org/operator:1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "a", Sources: []string{"cluster-1", "cluster-2"}},
+					{Name: "b"},
+				},
+			},
+		},
+	}
+
+	actual := WithSource(m, "merged.json")
+	containers := actual.DiscoveredImages[0].Containers
+	if len(containers[0].Sources) != 2 || containers[0].Sources[0] != "cluster-1" {
+		t.Errorf("WithSource replaced existing sources: %v", containers[0].Sources)
+	}
+	if len(containers[1].Sources) != 1 || containers[1].Sources[0] != "merged.json" {
+		t.Errorf("WithSource did not attribute the container to its source: %v", containers[1].Sources)
+	}
+}
@@ -0,0 +1,27 @@
+package discover
+
+import (
+	"github.com/opdev/discover-workload/discovery"
+)
+
+// MirrorResolver returns the canonical source of image and the locations it is
+// mirrored to. The canonical source is empty if image is not mirrored.
+type MirrorResolver func(image string) (canonical string, mirrors []string)
+
+// WithMirrors returns a copy of m in which each image records the canonical
+// source and mirrors of the image it was obtained from, as resolved by
+// resolve.
+func WithMirrors(m discovery.Manifest, resolve MirrorResolver) discovery.Manifest {
+	mirrored := discovery.Manifest{
+		DiscoveredImages: make([]discovery.DiscoveredImage, 0, len(m.DiscoveredImages)),
+	}
+	for _, image := range m.DiscoveredImages {
+		// A previous resolution is discarded, so that the image is resolved
+		// from where it was obtained.
+		image.CanonicalImage, image.MirrorImages = "", nil
+		image.CanonicalImage, image.MirrorImages = resolve(image.Origin())
+		mirrored.DiscoveredImages = append(mirrored.DiscoveredImages, image)
+	}
+
+	return mirrored
+}
@@ -0,0 +1,109 @@
+package discover
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+// testMirrors resolves the images of quay.io/org, which are mirrored to
+// mirror.example.com/org.
+func testMirrors(image string) (string, []string) {
+	if rest, found := strings.CutPrefix(image, "mirror.example.com/org/"); found {
+		image = "quay.io/org/" + rest
+	}
+	if rest, found := strings.CutPrefix(image, "quay.io/org/"); found {
+		return image, []string{"mirror.example.com/org/" + rest}
+	}
+
+	return "", nil
+}
+
+func TestWithMirrors(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		input             discovery.DiscoveredImage
+		expectedCanonical string
+		expectedMirrors   []string
+	}{
+		"mirrored image": {
+			input:             discovery.DiscoveredImage{Image: "mirror.example.com/org/app:1"},
+			expectedCanonical: "quay.io/org/app:1",
+			expectedMirrors:   []string{"mirror.example.com/org/app:1"},
+		},
+		"image which is not mirrored": {
+			input: discovery.DiscoveredImage{Image: "registry.example.com/org/app:1"},
+		},
+		"previous resolution is discarded": {
+			input: discovery.DiscoveredImage{
+				Image:          "mirror.example.com/org/app:2",
+				CanonicalImage: "quay.io/org/app:1",
+				MirrorImages:   []string{"mirror.example.com/org/app:1"},
+			},
+			expectedCanonical: "quay.io/org/app:2",
+			expectedMirrors:   []string{"mirror.example.com/org/app:2"},
+		},
+		"previous resolution of an image which is no longer mirrored": {
+			input: discovery.DiscoveredImage{
+				Image:          "registry.example.com/org/app:1",
+				CanonicalImage: "quay.io/org/app:1",
+				MirrorImages:   []string{"mirror.example.com/org/app:1"},
+			},
+		},
+		"ImageStream source image": {
+			input: discovery.DiscoveredImage{
+				Image:       testInternalImage,
+				ImageStream: "ns/app:1",
+				SourceImage: "mirror.example.com/org/app:1",
+			},
+			expectedCanonical: "quay.io/org/app:1",
+			expectedMirrors:   []string{"mirror.example.com/org/app:1"},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			m := discovery.Manifest{DiscoveredImages: []discovery.DiscoveredImage{tc.input}}
+			actual := WithMirrors(m, testMirrors).DiscoveredImages[0]
+			if actual.CanonicalImage != tc.expectedCanonical || !slices.Equal(actual.MirrorImages, tc.expectedMirrors) {
+				t.Errorf("WithMirrors resolved %q and %v; expected %q and %v", actual.CanonicalImage, actual.MirrorImages, tc.expectedCanonical, tc.expectedMirrors)
+			}
+			if m.DiscoveredImages[0].CanonicalImage != tc.input.CanonicalImage {
+				t.Error("WithMirrors modified its input")
+			}
+		})
+	}
+}
+
+func TestImageStreamsWithMirrors(t *testing.T) {
+	t.Parallel()
+	pods := []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "ns"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Image: testInternalImage}},
+			},
+		},
+	}
+
+	m := processPods(t, pods, NewManifestJSONProcessorFnOptions{
+		ImageStreams: testImageStreams,
+		Mirrors:      testMirrors,
+	})
+	if len(m.DiscoveredImages) != 1 {
+		t.Fatalf("the processor returned %d images; expected 1", len(m.DiscoveredImages))
+	}
+	image := m.DiscoveredImages[0]
+	if image.SourceImage != testStreamSource || image.CanonicalImage != testStreamSource {
+		t.Errorf("the processor resolved SourceImage %q and CanonicalImage %q; expected both to be %q", image.SourceImage, image.CanonicalImage, testStreamSource)
+	}
+	if expected := []string{"mirror.example.com/org/app:1"}; !slices.Equal(image.MirrorImages, expected) {
+		t.Errorf("the processor resolved the mirrors %v; expected %v", image.MirrorImages, expected)
+	}
+}
@@ -0,0 +1,172 @@
+package discover
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ReadPodsFromMustGather reads pods and workloads collected by an OpenShift
+// must-gather or oc adm inspect, either from the directory it was written to,
+// or from a .tar.gz (or .tgz) archive of that directory. Only the files
+// namespaces/<ns>/core/pods.yaml and namespaces/<ns>/apps/*.yaml are read.
+// Workloads which own collected pods, directly or through other workloads,
+// are not converted to pods of their own, so that each running container is
+// only reported once.
+func ReadPodsFromMustGather(mustGatherPath string, logger *slog.Logger) ([]*corev1.Pod, error) {
+	info, err := os.Stat(mustGatherPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return readPodsFromMustGatherDir(mustGatherPath, logger)
+	}
+
+	lower := strings.ToLower(mustGatherPath)
+	if strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") {
+		return readPodsFromMustGatherArchive(mustGatherPath, logger)
+	}
+
+	return nil, fmt.Errorf("must-gather %s must be a directory or a .tar.gz archive", mustGatherPath)
+}
+
+func readPodsFromMustGatherDir(dir string, logger *slog.Logger) ([]*corev1.Pod, error) {
+	var decoded []decodedPod
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isMustGatherWorkloadFile(filepath.ToSlash(p)) {
+			return nil
+		}
+
+		found, err := readWorkloadsFromFile(p, logger)
+		if err != nil {
+			return err
+		}
+		decoded = append(decoded, found...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return withoutRunningWorkloads(decoded), nil
+}
+
+func readPodsFromMustGatherArchive(archivePath string, logger *slog.Logger) ([]*corev1.Pod, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress %s: %w", archivePath, err)
+	}
+	defer gz.Close()
+
+	var decoded []decodedPod
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return withoutRunningWorkloads(decoded), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", archivePath, err)
+		}
+
+		if header.Typeflag != tar.TypeReg || !isMustGatherWorkloadFile(header.Name) {
+			continue
+		}
+
+		logger.Debug("reading workloads from archive", "archive", archivePath, "path", header.Name)
+		found, err := decodeWorkloads(archive, logger)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read workloads from %s in %s: %w", header.Name, archivePath, err)
+		}
+		decoded = append(decoded, found...)
+	}
+}
+
+// ownerKey identifies a workload within its namespace, as an owner reference
+// does.
+type ownerKey struct {
+	Namespace string
+	Kind      string
+	Name      string
+}
+
+// withoutRunningWorkloads returns the pods of decoded, except those built from
+// workloads which own one of the pods decoded as-is, e.g. the ReplicaSet of a
+// running pod and the Deployment owning that ReplicaSet.
+func withoutRunningWorkloads(decoded []decodedPod) []*corev1.Pod {
+	owners := map[ownerKey][]metav1.OwnerReference{}
+	for _, d := range decoded {
+		if d.workload != nil {
+			key := ownerKey{Namespace: d.workload.Namespace, Kind: d.workload.Kind, Name: d.workload.Name}
+			owners[key] = d.workload.OwnerReferences
+		}
+	}
+
+	running := map[ownerKey]bool{}
+	var markRunning func(namespace string, refs []metav1.OwnerReference)
+	markRunning = func(namespace string, refs []metav1.OwnerReference) {
+		for _, ref := range refs {
+			key := ownerKey{Namespace: namespace, Kind: ref.Kind, Name: ref.Name}
+			if running[key] {
+				continue
+			}
+			running[key] = true
+			markRunning(namespace, owners[key])
+		}
+	}
+	for _, d := range decoded {
+		if d.workload == nil {
+			markRunning(d.pod.Namespace, d.pod.OwnerReferences)
+		}
+	}
+
+	var pods []*corev1.Pod
+	for _, d := range decoded {
+		if d.workload != nil && running[ownerKey{Namespace: d.workload.Namespace, Kind: d.workload.Kind, Name: d.workload.Name}] {
+			continue
+		}
+		pods = append(pods, d.pod)
+	}
+
+	return pods
+}
+
+// isMustGatherWorkloadFile reports whether the slash-separated path p is
+// namespaces/<ns>/core/pods.yaml, or a YAML file in namespaces/<ns>/apps.
+func isMustGatherWorkloadFile(p string) bool {
+	segments := strings.Split(path.Clean(p), "/")
+	if len(segments) < 4 || segments[len(segments)-4] != "namespaces" {
+		return false
+	}
+
+	group, file := segments[len(segments)-2], segments[len(segments)-1]
+	switch group {
+	case "core":
+		return file == "pods.yaml"
+	case "apps":
+		return path.Ext(file) == ".yaml"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,197 @@
+package discover
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+// mustGatherFiles is a minimal must-gather layout. Only the pods and apps files
+// should be read.
+var mustGatherFiles = map[string]string{
+	"must-gather.local/quay-io-image/namespaces/ns-1/core/pods.yaml": `
+apiVersion: v1
+kind: PodList
+items:
+- metadata:
+    name: operator-5f6d8b-abc12
+    namespace: ns-1
+    ownerReferences:
+    - apiVersion: apps/v1
+      kind: ReplicaSet
+      name: operator-5f6d8b
+      uid: 3c1e5b0a-0000-4000-8000-000000000001
+  spec:
+    containers:
+    - name: manager
+      image: example.com/org/operator:1
+`,
+	"must-gather.local/quay-io-image/namespaces/ns-1/apps/statefulsets.yaml": `
+apiVersion: apps/v1
+kind: StatefulSetList
+items:
+- metadata:
+    name: database
+    namespace: ns-1
+  spec:
+    template:
+      spec:
+        containers:
+        - name: db
+          image: example.com/org/db:1
+`,
+	// The running pod's ReplicaSet and Deployment are not reported again,
+	// and the old revision of the Deployment, scaled to zero, runs no pods.
+	"must-gather.local/quay-io-image/namespaces/ns-1/apps/deployments.yaml": `
+apiVersion: apps/v1
+kind: DeploymentList
+items:
+- metadata:
+    name: operator
+    namespace: ns-1
+  spec:
+    template:
+      spec:
+        containers:
+        - name: manager
+          image: example.com/org/operator:1
+`,
+	"must-gather.local/quay-io-image/namespaces/ns-1/apps/replicasets.yaml": `
+apiVersion: apps/v1
+kind: ReplicaSetList
+items:
+- metadata:
+    name: operator-5f6d8b
+    namespace: ns-1
+    ownerReferences:
+    - apiVersion: apps/v1
+      kind: Deployment
+      name: operator
+      uid: 3c1e5b0a-0000-4000-8000-000000000002
+  spec:
+    replicas: 1
+    template:
+      spec:
+        containers:
+        - name: manager
+          image: example.com/org/operator:1
+- metadata:
+    name: operator-7d4b9c
+    namespace: ns-1
+  spec:
+    replicas: 0
+    template:
+      spec:
+        containers:
+        - name: manager
+          image: example.com/org/operator:0.9
+`,
+	"must-gather.local/quay-io-image/namespaces/ns-1/core/configmaps.yaml": `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: not-read
+  namespace: ns-1
+`,
+	"must-gather.local/quay-io-image/cluster-scoped-resources/core/nodes.yaml": `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: not-read
+`,
+}
+
+func TestReadPodsFromMustGatherDir(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	for name, content := range mustGatherFiles {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pods, err := ReadPodsFromMustGather(dir, NewSlogDiscardLogger())
+	if err != nil {
+		t.Fatalf("ReadPodsFromMustGather returned an unexpected error: %q", err)
+	}
+
+	m := discovery.Manifest{}
+	for _, p := range pods {
+		m = appendToManifest(m, processContainers(p, NewSlogDiscardLogger())...)
+	}
+	idx := slices.IndexFunc(m.DiscoveredImages, func(image discovery.DiscoveredImage) bool { return image.Image == "example.com/org/operator:1" })
+	if idx < 0 || len(m.DiscoveredImages[idx].Containers) != 1 {
+		t.Fatalf("ReadPodsFromMustGather returned pods with images %v; expected a single manager container", m.DiscoveredImages)
+	}
+
+	actual := podNames(pods)
+	slices.Sort(actual)
+	expected := []string{"ns-1/database", "ns-1/operator-5f6d8b-abc12"}
+	if !slices.Equal(actual, expected) {
+		t.Fatalf("ReadPodsFromMustGather returned pods %v; expected %v", actual, expected)
+	}
+}
+
+func TestReadPodsFromMustGatherArchive(t *testing.T) {
+	t.Parallel()
+	archivePath := filepath.Join(t.TempDir(), "must-gather.tar.gz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	archive := tar.NewWriter(gz)
+	for name, content := range mustGatherFiles {
+		header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []interface{ Close() error }{archive, gz, f} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pods, err := ReadPodsFromMustGather(archivePath, NewSlogDiscardLogger())
+	if err != nil {
+		t.Fatalf("ReadPodsFromMustGather returned an unexpected error: %q", err)
+	}
+
+	actual := podNames(pods)
+	slices.Sort(actual)
+	expected := []string{"ns-1/database", "ns-1/operator-5f6d8b-abc12"}
+	if !slices.Equal(actual, expected) {
+		t.Fatalf("ReadPodsFromMustGather returned pods %v; expected %v", actual, expected)
+	}
+}
+
+func TestIsMustGatherWorkloadFile(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]bool{
+		"namespaces/ns/core/pods.yaml":                   true,
+		"inspect.local/namespaces/ns/apps/replicas.yaml": true,
+		"namespaces/ns/core/services.yaml":               false,
+		"namespaces/ns/apps/README.md":                   false,
+		"namespaces/ns/pods/pod-1/pod-1.yaml":            false,
+		"core/pods.yaml":                                 false,
+	}
+
+	for input, expected := range testcases {
+		if actual := isMustGatherWorkloadFile(input); actual != expected {
+			t.Errorf("isMustGatherWorkloadFile(%q) returned %t; expected %t", input, actual, expected)
+		}
+	}
+}
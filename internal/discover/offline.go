@@ -0,0 +1,409 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// StdinPath is the path which refers to standard input when reading workloads
+// from files.
+const StdinPath = "-"
+
+// manifestExtensions are the file extensions read when a directory of
+// workloads is provided.
+var manifestExtensions = []string{".yaml", ".yml", ".json"}
+
+// podKinds are the kinds which define pods, either directly or through a pod
+// template. Lists of these kinds, e.g. PodList, are expanded.
+var podKinds = []string{
+	"Pod",
+	"Deployment",
+	"ReplicaSet",
+	"StatefulSet",
+	"DaemonSet",
+	"Job",
+	"CronJob",
+	"PodTemplate",
+	"ReplicationController",
+	"DeploymentConfig",
+}
+
+// ProcessPods sends pods to processorFn, as if they were discovered by
+// watching a cluster. It returns once processorFn completes.
+func ProcessPods(
+	ctx context.Context,
+	logger *slog.Logger,
+	pods []*corev1.Pod,
+	processorFn ProcessingFunction,
+) error {
+	podProcessing := make(chan *corev1.Pod)
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	var processorFnErr error
+	go func() {
+		defer wg.Done()
+		processorFnErr = processorFn(ctx, podProcessing, logger)
+	}()
+
+	logger.Info("processing workloads", "count", len(pods))
+	for _, p := range pods {
+		select {
+		case podProcessing <- p:
+		case <-ctx.Done():
+		}
+	}
+	close(podProcessing)
+
+	wg.Wait()
+	if processorFnErr != nil {
+		return processorFnErr
+	}
+	logger.Info("processing completed")
+	return nil
+}
+
+// FilterPods returns the pods which are in one of namespaces and match the
+// label and field selectors in listOptions. All namespaces match if none are
+// provided. Field selectors support the pod fields metadata.name,
+// metadata.namespace, spec.nodeName, spec.restartPolicy,
+// spec.schedulerName, spec.serviceAccountName and status.phase.
+func FilterPods(pods []*corev1.Pod, namespaces []string, listOptions metav1.ListOptions) ([]*corev1.Pod, error) {
+	labelSelector, err := labels.Parse(listOptions.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldSelector, err := fields.ParseSelector(listOptions.FieldSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]*corev1.Pod, 0, len(pods))
+	for _, p := range pods {
+		if len(namespaces) > 0 && !slices.Contains(namespaces, p.Namespace) {
+			continue
+		}
+		if !labelSelector.Matches(labels.Set(p.Labels)) || !fieldSelector.Matches(podFields(p)) {
+			continue
+		}
+		filtered = append(filtered, p)
+	}
+
+	return filtered, nil
+}
+
+// podFields returns the fields of p which can be used in field selectors,
+// mirroring those supported by the Kubernetes API server.
+func podFields(p *corev1.Pod) fields.Set {
+	return fields.Set{
+		"metadata.name":           p.Name,
+		"metadata.namespace":      p.Namespace,
+		"spec.nodeName":           p.Spec.NodeName,
+		"spec.restartPolicy":      string(p.Spec.RestartPolicy),
+		"spec.schedulerName":      p.Spec.SchedulerName,
+		"spec.serviceAccountName": p.Spec.ServiceAccountName,
+		"status.phase":            string(p.Status.Phase),
+	}
+}
+
+// ReadPodsFromPaths reads pods and workloads from each of paths. A path may be
+// a file, a directory whose YAML and JSON files are read recursively, or
+// StdinPath to read from stdin.
+func ReadPodsFromPaths(paths []string, stdin io.Reader, logger *slog.Logger) ([]*corev1.Pod, error) {
+	var pods []*corev1.Pod
+	for _, path := range paths {
+		if path == StdinPath {
+			found, err := DecodePods(stdin, logger)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read workloads from stdin: %w", err)
+			}
+			pods = append(pods, found...)
+			continue
+		}
+
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// Files provided explicitly are always read, but directories are
+			// filtered by extension.
+			if d.IsDir() || (p != path && !slices.Contains(manifestExtensions, strings.ToLower(filepath.Ext(p)))) {
+				return nil
+			}
+
+			found, err := readPodsFromFile(p, logger)
+			if err != nil {
+				return err
+			}
+			pods = append(pods, found...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pods, nil
+}
+
+func readPodsFromFile(path string, logger *slog.Logger) ([]*corev1.Pod, error) {
+	decoded, err := readWorkloadsFromFile(path, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return podsOf(decoded), nil
+}
+
+func readWorkloadsFromFile(path string, logger *slog.Logger) ([]decodedPod, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	logger.Debug("reading workloads from file", "path", path)
+	decoded, err := decodeWorkloads(f, logger)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read workloads from %s: %w", path, err)
+	}
+
+	return decoded, nil
+}
+
+// decodedPod is a pod decoded from a manifest. For a pod built from the
+// template of a workload, workload holds the kind and metadata of the
+// workload.
+type decodedPod struct {
+	pod      *corev1.Pod
+	workload *metav1.PartialObjectMetadata
+}
+
+func podsOf(decoded []decodedPod) []*corev1.Pod {
+	var pods []*corev1.Pod
+	for _, d := range decoded {
+		pods = append(pods, d.pod)
+	}
+
+	return pods
+}
+
+// DecodePods decodes a stream of YAML documents or JSON objects into pods.
+// Pods are returned as-is. Workloads (e.g. Deployments, StatefulSets, Jobs) are
+// converted to a pod named after the workload, using its pod template. Lists,
+// and lists of pods and workloads such as PodList, are expanded. Objects of any
+// other kind are ignored.
+func DecodePods(r io.Reader, logger *slog.Logger) ([]*corev1.Pod, error) {
+	decoded, err := decodeWorkloads(r, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return podsOf(decoded), nil
+}
+
+// decodeWorkloads decodes r as DecodePods does, keeping the workload each pod
+// was built from.
+func decodeWorkloads(r io.Reader, logger *slog.Logger) ([]decodedPod, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	var decoded []decodedPod
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return decoded, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		found, err := decodeObject(raw, logger)
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, found...)
+	}
+}
+
+// decodeObject converts a single JSON-encoded Kubernetes object into pods.
+func decodeObject(raw json.RawMessage, logger *slog.Logger) ([]decodedPod, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	typeMeta := metav1.TypeMeta{}
+	if err := json.Unmarshal(raw, &typeMeta); err != nil {
+		return nil, err
+	}
+
+	switch kind := typeMeta.Kind; {
+	case kind == "List" || isPodListKind(kind):
+		list := struct {
+			Items []json.RawMessage `json:"items"`
+		}{}
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, err
+		}
+
+		var decoded []decodedPod
+		for _, item := range list.Items {
+			// Items of typed lists, e.g. PodList, often omit their kind.
+			if kind != "List" {
+				item = withKind(item, strings.TrimSuffix(kind, "List"), typeMeta.APIVersion)
+			}
+			found, err := decodeObject(item, logger)
+			if err != nil {
+				return nil, err
+			}
+			decoded = append(decoded, found...)
+		}
+		return decoded, nil
+	case kind == "Pod":
+		p := &corev1.Pod{}
+		if err := json.Unmarshal(raw, p); err != nil {
+			return nil, err
+		}
+		return []decodedPod{{pod: p}}, nil
+	default:
+		template, meta, found, err := decodePodTemplate(kind, raw)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			logger.Debug("ignoring object that does not run pods", "kind", kind, "apiVersion", typeMeta.APIVersion)
+			return nil, nil
+		}
+		workload := &metav1.PartialObjectMetadata{TypeMeta: typeMeta, ObjectMeta: meta}
+		return []decodedPod{{pod: podFromTemplate(meta, template), workload: workload}}, nil
+	}
+}
+
+// isPodListKind reports whether kind is a list of one of podKinds, e.g.
+// DeploymentList. Custom resources whose kind merely ends in List are not.
+func isPodListKind(kind string) bool {
+	itemKind, found := strings.CutSuffix(kind, "List")
+	return found && slices.Contains(podKinds, itemKind)
+}
+
+// withKind sets the kind and apiVersion of item, if it does not already define
+// a kind.
+func withKind(item json.RawMessage, kind, apiVersion string) json.RawMessage {
+	typeMeta := metav1.TypeMeta{}
+	if err := json.Unmarshal(item, &typeMeta); err != nil || typeMeta.Kind != "" {
+		return item
+	}
+
+	obj := map[string]any{}
+	if err := json.Unmarshal(item, &obj); err != nil {
+		return item
+	}
+	obj["kind"] = kind
+	obj["apiVersion"] = apiVersion
+	withKind, err := json.Marshal(obj)
+	if err != nil {
+		return item
+	}
+
+	return withKind
+}
+
+// decodePodTemplate extracts the pod template from workload kinds that define
+// one. found is false for kinds which do not, and for ReplicaSets scaled to
+// zero, such as the old revisions a Deployment keeps for its history, which
+// run no pods.
+func decodePodTemplate(kind string, raw json.RawMessage) (template corev1.PodTemplateSpec, meta metav1.ObjectMeta, found bool, err error) {
+	switch kind {
+	case "Deployment":
+		obj := appsv1.Deployment{}
+		err = json.Unmarshal(raw, &obj)
+		return obj.Spec.Template, obj.ObjectMeta, true, err
+	case "ReplicaSet":
+		obj := appsv1.ReplicaSet{}
+		err = json.Unmarshal(raw, &obj)
+		scaledDown := obj.Spec.Replicas != nil && *obj.Spec.Replicas == 0
+		return obj.Spec.Template, obj.ObjectMeta, !scaledDown, err
+	case "StatefulSet":
+		obj := appsv1.StatefulSet{}
+		err = json.Unmarshal(raw, &obj)
+		return obj.Spec.Template, obj.ObjectMeta, true, err
+	case "DaemonSet":
+		obj := appsv1.DaemonSet{}
+		err = json.Unmarshal(raw, &obj)
+		return obj.Spec.Template, obj.ObjectMeta, true, err
+	case "Job":
+		obj := batchv1.Job{}
+		err = json.Unmarshal(raw, &obj)
+		return obj.Spec.Template, obj.ObjectMeta, true, err
+	case "CronJob":
+		obj := batchv1.CronJob{}
+		err = json.Unmarshal(raw, &obj)
+		return obj.Spec.JobTemplate.Spec.Template, obj.ObjectMeta, true, err
+	case "PodTemplate":
+		obj := corev1.PodTemplate{}
+		err = json.Unmarshal(raw, &obj)
+		return obj.Template, obj.ObjectMeta, true, err
+	case "ReplicationController", "DeploymentConfig":
+		// DeploymentConfigs (apps.openshift.io) share the shape of a
+		// ReplicationController's template.
+		obj := corev1.ReplicationController{}
+		err = json.Unmarshal(raw, &obj)
+		if obj.Spec.Template == nil {
+			return template, obj.ObjectMeta, false, err
+		}
+		return *obj.Spec.Template, obj.ObjectMeta, true, err
+	default:
+		return template, meta, false, nil
+	}
+}
+
+// podFromTemplate builds the pod a workload would create from template. The
+// pod is named after the workload, and placed in its namespace. Its labels are
+// those of the template, as in a cluster, so that selectors match the same
+// pods. The workload's annotations are kept on the pod, unless the template
+// overrides them, so that the Helm release which installed it is known.
+func podFromTemplate(meta metav1.ObjectMeta, template corev1.PodTemplateSpec) *corev1.Pod {
+	p := &corev1.Pod{
+		ObjectMeta: *template.ObjectMeta.DeepCopy(),
+		Spec:       *template.Spec.DeepCopy(),
+	}
+	p.Name = meta.Name
+	p.Namespace = meta.Namespace
+	p.Annotations = withDefaults(p.Annotations, meta.Annotations)
+
+	return p
+}
+
+// withDefaults returns values with the entries of defaults it does not set.
+func withDefaults(values, defaults map[string]string) map[string]string {
+	for key, value := range defaults {
+		if _, found := values[key]; !found {
+			if values == nil {
+				values = map[string]string{}
+			}
+			values[key] = value
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,269 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const offlineWorkloads = `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: standalone
+  namespace: ns-1
+  labels:
+    app: standalone
+spec:
+  containers:
+  - name: main
+    image: example.com/org/standalone:1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: operator
+  namespace: ns-1
+  labels:
+    app: deployment
+    olm.owner: my-operator.v1.0.0
+spec:
+  template:
+    metadata:
+      labels:
+        app: operator
+    spec:
+      containers:
+      - name: manager
+        image: example.com/org/operator:1
+---
+# Objects without pods are ignored.
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: ns-1
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+  namespace: ns-2
+spec:
+  schedule: "@daily"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: cleanup
+            image: example.com/org/cleanup:1
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: apps/v1
+  kind: StatefulSet
+  metadata:
+    name: database
+    namespace: ns-2
+  spec:
+    template:
+      spec:
+        containers:
+        - name: db
+          image: example.com/org/db:1
+`
+
+// offlineCustomList is a custom resource whose kind ends in List, and which
+// embeds objects shaped like pods that are not run.
+const offlineCustomList = `
+apiVersion: example.com/v1
+kind: AllowList
+metadata:
+  name: allowed
+  namespace: ns-1
+items:
+- apiVersion: v1
+  kind: Pod
+  metadata:
+    name: not-a-pod
+  spec:
+    containers:
+    - name: main
+      image: example.com/org/allowed:1
+`
+
+const offlinePodList = `{
+  "apiVersion": "v1",
+  "kind": "PodList",
+  "items": [
+    {
+      "metadata": {"name": "listed", "namespace": "ns-3"},
+      "spec": {"containers": [{"name": "main", "image": "example.com/org/listed:1"}]}
+    }
+  ]
+}`
+
+func podNames(pods []*corev1.Pod) []string {
+	names := make([]string, 0, len(pods))
+	for _, p := range pods {
+		names = append(names, p.Namespace+"/"+p.Name)
+	}
+
+	return names
+}
+
+func TestDecodePods(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		input    string
+		expected []string
+	}{
+		"multi-document yaml": {
+			input:    offlineWorkloads,
+			expected: []string{"ns-1/standalone", "ns-1/operator", "ns-2/cleanup", "ns-2/database"},
+		},
+		"json pod list": {
+			input:    offlinePodList,
+			expected: []string{"ns-3/listed"},
+		},
+		"custom resource named like a list": {
+			input:    offlineCustomList,
+			expected: []string{},
+		},
+		"empty": {
+			input:    "",
+			expected: []string{},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			pods, err := DecodePods(strings.NewReader(tc.input), NewSlogDiscardLogger())
+			if err != nil {
+				t.Fatalf("DecodePods returned an unexpected error: %q", err)
+			}
+
+			if actual := podNames(pods); !slices.Equal(actual, tc.expected) {
+				t.Fatalf("DecodePods returned pods %v; expected %v", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestDecodePodsFromTemplate(t *testing.T) {
+	t.Parallel()
+	pods, err := DecodePods(strings.NewReader(offlineWorkloads), NewSlogDiscardLogger())
+	if err != nil {
+		t.Fatalf("DecodePods returned an unexpected error: %q", err)
+	}
+
+	operator := pods[1]
+	if operator.Labels["app"] != "operator" {
+		t.Errorf("pod did not inherit the labels of its template: %v", operator.Labels)
+	}
+	if _, found := operator.Labels["olm.owner"]; found {
+		t.Errorf("pod inherited the labels of its workload rather than only its template: %v", operator.Labels)
+	}
+	if len(operator.Spec.Containers) != 1 || operator.Spec.Containers[0].Image != "example.com/org/operator:1" {
+		t.Errorf("pod did not inherit the containers of its template: %v", operator.Spec.Containers)
+	}
+}
+
+func TestFilterPods(t *testing.T) {
+	t.Parallel()
+	pods, err := DecodePods(strings.NewReader(offlineWorkloads), NewSlogDiscardLogger())
+	if err != nil {
+		t.Fatalf("DecodePods returned an unexpected error: %q", err)
+	}
+
+	testcases := map[string]struct {
+		namespaces  []string
+		listOptions metav1.ListOptions
+		expected    []string
+	}{
+		"no filters": {
+			expected: []string{"ns-1/standalone", "ns-1/operator", "ns-2/cleanup", "ns-2/database"},
+		},
+		"namespace": {
+			namespaces: []string{"ns-2"},
+			expected:   []string{"ns-2/cleanup", "ns-2/database"},
+		},
+		"label selector": {
+			listOptions: metav1.ListOptions{LabelSelector: "app in (operator, standalone)"},
+			expected:    []string{"ns-1/standalone", "ns-1/operator"},
+		},
+		"label only on the workload": {
+			listOptions: metav1.ListOptions{LabelSelector: "app=deployment"},
+			expected:    nil,
+		},
+		"field selector": {
+			listOptions: metav1.ListOptions{FieldSelector: "metadata.name!=cleanup"},
+			namespaces:  []string{"ns-2"},
+			expected:    []string{"ns-2/database"},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			filtered, err := FilterPods(pods, tc.namespaces, tc.listOptions)
+			if err != nil {
+				t.Fatalf("FilterPods returned an unexpected error: %q", err)
+			}
+
+			if actual := podNames(filtered); !slices.Equal(actual, tc.expected) {
+				t.Fatalf("FilterPods returned pods %v; expected %v", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestReadPodsFromPaths(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "workloads.yaml"), []byte(offlineWorkloads), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a manifest"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pods, err := ReadPodsFromPaths([]string{dir, StdinPath}, strings.NewReader(offlinePodList), NewSlogDiscardLogger())
+	if err != nil {
+		t.Fatalf("ReadPodsFromPaths returned an unexpected error: %q", err)
+	}
+
+	expected := []string{"ns-1/standalone", "ns-1/operator", "ns-2/cleanup", "ns-2/database", "ns-3/listed"}
+	if actual := podNames(pods); !slices.Equal(actual, expected) {
+		t.Fatalf("ReadPodsFromPaths returned pods %v; expected %v", actual, expected)
+	}
+}
+
+func TestProcessPods(t *testing.T) {
+	t.Parallel()
+	pods, err := DecodePods(strings.NewReader(offlinePodList), NewSlogDiscardLogger())
+	if err != nil {
+		t.Fatalf("DecodePods returned an unexpected error: %q", err)
+	}
+
+	buffer := &bytes.Buffer{}
+	fn := NewManifestJSONProcessorFn(buffer, NewManifestJSONProcessorFnOptions{CompactOutput: true})
+	if err := ProcessPods(context.TODO(), NewSlogDiscardLogger(), pods, fn); err != nil {
+		t.Fatalf("ProcessPods returned an unexpected error: %q", err)
+	}
+
+	expected := "{\"DiscoveredImages\":[{\"Image\":\"example.com/org/listed:1\",\"Containers\":[{\"Name\":\"main\",\"Type\":\"Container\",\"Pod\":{\"Name\":\"listed\",\"Namespace\":\"ns-3\"}}]}]}\n"
+	if buffer.String() != expected {
+		t.Fatalf("ProcessPods produced %q; expected %q", buffer.String(), expected)
+	}
+}
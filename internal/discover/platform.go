@@ -0,0 +1,109 @@
+package discover
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+// PlatformResolver returns the platform of the node named nodeName, e.g.
+// "linux/amd64", or an empty string if it is unknown.
+type PlatformResolver func(ctx context.Context, nodeName string) string
+
+// NewPlatformResolver returns a PlatformResolver which retrieves nodes with
+// client. Each node is only retrieved once, so the returned resolver must not
+// be used concurrently.
+func NewPlatformResolver(client kubernetes.Interface, logger *slog.Logger) PlatformResolver {
+	platforms := map[string]string{}
+	return func(ctx context.Context, nodeName string) string {
+		if platform, found := platforms[nodeName]; found {
+			return platform
+		}
+
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			logger.Debug("unable to look up node", "name", nodeName, "errMsg", err)
+			return ""
+		}
+
+		platforms[nodeName] = NodePlatform(node)
+		return platforms[nodeName]
+	}
+}
+
+// NodePlatform returns the platform of node from its well-known os and arch
+// labels, falling back to the node info reported by its kubelet.
+func NodePlatform(node *corev1.Node) string {
+	os := node.Labels[corev1.LabelOSStable]
+	if os == "" {
+		os = node.Status.NodeInfo.OperatingSystem
+	}
+	arch := node.Labels[corev1.LabelArchStable]
+	if arch == "" {
+		arch = node.Status.NodeInfo.Architecture
+	}
+
+	if os == "" || arch == "" {
+		return ""
+	}
+
+	return os + "/" + arch
+}
+
+// withPlatform records platform on every container of images.
+func withPlatform(images []discovery.DiscoveredImage, platform string) {
+	for i := range images {
+		for j := range images[i].Containers {
+			images[i].Containers[j].Platform = platform
+		}
+	}
+}
+
+// SummarizePlatforms returns a copy of m in which each image lists the
+// platforms its containers ran on, in sorted order.
+func SummarizePlatforms(m discovery.Manifest) discovery.Manifest {
+	summarized := discovery.Manifest{
+		DiscoveredImages: make([]discovery.DiscoveredImage, 0, len(m.DiscoveredImages)),
+	}
+	for _, image := range m.DiscoveredImages {
+		image.RequiredPlatforms = nil
+		for _, c := range image.Containers {
+			if c.Platform != "" && !slices.Contains(image.RequiredPlatforms, c.Platform) {
+				image.RequiredPlatforms = append(image.RequiredPlatforms, c.Platform)
+			}
+		}
+		slices.Sort(image.RequiredPlatforms)
+		summarized.DiscoveredImages = append(summarized.DiscoveredImages, image)
+	}
+
+	return summarized
+}
+
+// MissingPlatforms returns the platforms image is required to support which
+// its registry inspection does not list. A platform with a variant, e.g.
+// "linux/arm64/v8", satisfies the platform without one. Nil is returned if the
+// image was not inspected.
+func MissingPlatforms(image discovery.DiscoveredImage) []string {
+	if image.Inspection == nil || image.Inspection.Error != "" {
+		return nil
+	}
+
+	var missing []string
+	for _, required := range image.RequiredPlatforms {
+		covered := slices.ContainsFunc(image.Inspection.Platforms, func(p string) bool {
+			return p == required || strings.HasPrefix(p, required+"/")
+		})
+		if !covered {
+			missing = append(missing, required)
+		}
+	}
+
+	return missing
+}
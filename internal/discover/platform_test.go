@@ -0,0 +1,126 @@
+package discover
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func TestNodePlatforms(t *testing.T) {
+	t.Parallel()
+	client := fake.NewClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{
+			Name:   "amd64-node",
+			Labels: map[string]string{corev1.LabelOSStable: "linux", corev1.LabelArchStable: "amd64"},
+		}},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "arm64-node"},
+			Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{
+				OperatingSystem: "linux",
+				Architecture:    "arm64",
+			}},
+		},
+	)
+	resolver := NewPlatformResolver(client, NewSlogDiscardLogger())
+
+	pods := []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-amd64", Namespace: "ns"},
+			Spec: corev1.PodSpec{
+				NodeName:   "amd64-node",
+				Containers: []corev1.Container{{Name: "app", Image: "example.com/namespace/app:0.0.1"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "app-arm64", Namespace: "ns"},
+			Spec: corev1.PodSpec{
+				NodeName:   "arm64-node",
+				Containers: []corev1.Container{{Name: "app", Image: "example.com/namespace/app:0.0.1"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "unscheduled", Namespace: "ns"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "db", Image: "example.com/namespace/db:0.0.1"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "removed-node", Namespace: "ns"},
+			Spec: corev1.PodSpec{
+				NodeName:   "missing-node",
+				Containers: []corev1.Container{{Name: "db", Image: "example.com/namespace/db:0.0.1"}},
+			},
+		},
+	}
+
+	source := make(chan *corev1.Pod, len(pods))
+	for _, p := range pods {
+		source <- p
+	}
+	close(source)
+
+	var m discovery.Manifest
+	processorFn := NewManifestJSONProcessorFn(nil, NewManifestJSONProcessorFnOptions{
+		Platforms: resolver,
+		Writer: func(_ io.Writer, found discovery.Manifest) error {
+			m = found
+			return nil
+		},
+	})
+	if err := processorFn(context.TODO(), source, NewSlogDiscardLogger()); err != nil {
+		t.Fatalf("processorFn returned an unexpected error: %q", err)
+	}
+
+	expected := map[string][]string{
+		"example.com/namespace/app:0.0.1": {"linux/amd64", "linux/arm64"},
+		"example.com/namespace/db:0.0.1":  nil,
+	}
+	for _, image := range m.DiscoveredImages {
+		if !slices.Equal(image.RequiredPlatforms, expected[image.Image]) {
+			t.Errorf("image %s requires platforms %v; expected %v", image.Image, image.RequiredPlatforms, expected[image.Image])
+		}
+		for _, c := range image.Containers {
+			if c.Pod.Name == "app-arm64" && c.Platform != "linux/arm64" {
+				t.Errorf("container %s in pod %s ran on %q; expected linux/arm64", c.Name, c.Pod.Name, c.Platform)
+			}
+		}
+	}
+}
+
+func TestMissingPlatforms(t *testing.T) {
+	t.Parallel()
+	required := []string{"linux/amd64", "linux/arm64", "linux/s390x"}
+	testcases := map[string]struct {
+		inspection *discovery.ImageInspection
+		expected   []string
+	}{
+		"not inspected": {},
+		"inspection failed": {
+			inspection: &discovery.ImageInspection{Error: "unauthorized"},
+		},
+		"variants satisfy the platform": {
+			inspection: &discovery.ImageInspection{Platforms: []string{"linux/amd64", "linux/arm64/v8"}},
+			expected:   []string{"linux/s390x"},
+		},
+		"every platform is covered": {
+			inspection: &discovery.ImageInspection{Platforms: []string{"linux/amd64", "linux/arm64", "linux/s390x", "linux/ppc64le"}},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			image := discovery.DiscoveredImage{RequiredPlatforms: required, Inspection: tc.inspection}
+			if actual := MissingPlatforms(image); !slices.Equal(actual, tc.expected) {
+				t.Fatalf("MissingPlatforms returned %v; expected %v", actual, tc.expected)
+			}
+		})
+	}
+}
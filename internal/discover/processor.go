@@ -2,10 +2,9 @@ package discover
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"io"
 	"log/slog"
+	"regexp"
 	"slices"
 
 	corev1 "k8s.io/api/core/v1"
@@ -15,11 +14,73 @@ import (
 
 type NewManifestJSONProcessorFnOptions struct {
 	CompactOutput bool
+
+	// Sort is the order applied to the manifest before it is written. An
+	// empty value is treated as SortByImage.
+	Sort SortOrder
+
+	// EnvImagePattern, if set, selects the container environment variables
+	// whose values are collected as referenced images, e.g. ^RELATED_IMAGE_.
+	EnvImagePattern *regexp.Regexp
+
+	// Writer, if set, writes the manifest instead of the default JSON
+	// encoding. CompactOutput is ignored when Writer is set.
+	Writer ManifestWriter
+
+	// Source, if set, is recorded as the source of every discovered
+	// container, so that manifests from several runs can later be merged.
+	Source string
+
+	// Components, if set, resolves the operator or Helm release which
+	// deployed each pod, and records it on the pod's containers.
+	Components ComponentResolver
+
+	// Platforms, if set, resolves the platform of the node each pod was
+	// scheduled on, which is recorded on the pod's containers and summarized
+	// for each image.
+	Platforms PlatformResolver
+
+	// ImageStreams, if set, resolves images in the OpenShift internal
+	// registry to their ImageStream and the external image it imported.
+	ImageStreams ImageStreamResolver
+
+	// Mirrors, if set, resolves the canonical source of each image and the
+	// locations it is mirrored to.
+	Mirrors MirrorResolver
+
+	// ContainerTypes, if set, limits the manifest to containers of these
+	// types. Referenced images are kept.
+	ContainerTypes []discovery.ContainerType
+
+	// ExcludeReferences removes the images which were only referenced, such
+	// as those in environment variables or custom resources, from the
+	// manifest.
+	ExcludeReferences bool
+
+	// InjectionRules, if set, detect the containers injected into pods by
+	// service meshes and webhooks, which are marked with their injector.
+	InjectionRules []InjectionRule
+
+	// ExcludeInjected removes the containers detected by InjectionRules from
+	// the manifest.
+	ExcludeInjected bool
+
+	// RegistryRules, if set, categorize each image by its repository.
+	RegistryRules []RegistryRule
+
+	// Categories, if set, limits the manifest to images of these categories.
+	// Images are only categorized when RegistryRules is set.
+	Categories []discovery.ImageCategory
+
+	// Include, if set, is merged into the discovered manifest, e.g. images
+	// found in custom resources before the watch started.
+	Include discovery.Manifest
 }
 
 // NewManifestJSONProcessorFn produces a ProcessingFunction that will write a
-// Manifest in JSON to out. This Processor finds all images from containers,
-// initContainers, and ephemeralContainers.
+// Manifest in JSON, or using the Writer in opts, to out. This Processor finds
+// all images from containers, initContainers, ephemeralContainers, and image
+// volumes.
 func NewManifestJSONProcessorFn(out io.Writer, opts NewManifestJSONProcessorFnOptions) ProcessingFunction {
 	return func(ctx context.Context, source <-chan *corev1.Pod, logger *slog.Logger) error {
 		m := discovery.Manifest{}
@@ -33,37 +94,94 @@ func NewManifestJSONProcessorFn(out io.Writer, opts NewManifestJSONProcessorFnOp
 					continueRunning = false
 					break
 				}
-				m = appendToManifest(m, processContainers(p, logger)...)
+				found := processContainers(p, logger)
+				if opts.EnvImagePattern != nil {
+					found = append(found, processEnvReferences(p, opts.EnvImagePattern, logger)...)
+				}
+				if len(opts.InjectionRules) > 0 {
+					markInjected(found, p, opts.InjectionRules)
+				}
+				if opts.Components != nil {
+					withComponent(found, opts.Components(ctx, p))
+				}
+				if opts.Platforms != nil && p.Spec.NodeName != "" {
+					withPlatform(found, opts.Platforms(ctx, p.Spec.NodeName))
+				}
+				if opts.ImageStreams != nil {
+					withImageStreams(ctx, found, opts.ImageStreams)
+				}
+				m = appendToManifest(m, found...)
 			case <-ctx.Done():
 				logger.Debug("processorFn completing because the context completed")
 				continueRunning = false
 			}
 		}
 
+		m = appendToManifest(m, opts.Include.DiscoveredImages...)
+		if opts.Mirrors != nil {
+			m = WithMirrors(m, opts.Mirrors)
+		}
+		if len(opts.ContainerTypes) > 0 {
+			m = FilterContainerTypes(m, opts.ContainerTypes)
+		}
+		if opts.ExcludeReferences {
+			m = ExcludeReferences(m)
+		}
+		if opts.ExcludeInjected {
+			m = ExcludeInjected(m)
+		}
+		if len(opts.RegistryRules) > 0 {
+			m = Categorize(m, opts.RegistryRules)
+		}
+		if len(opts.Categories) > 0 {
+			m = FilterCategories(m, opts.Categories)
+		}
+		if opts.Platforms != nil {
+			m = SummarizePlatforms(m)
+		}
+
 		if len(m.DiscoveredImages) == 0 {
 			logger.Info("will not write manifest because no workloads were discovered")
 			return nil
 		}
 
-		var manifestJSON []byte
-		var err error
-		if opts.CompactOutput {
-			manifestJSON, err = json.Marshal(m)
-		} else {
-			manifestJSON, err = json.MarshalIndent(m, "", "    ")
+		if opts.Source != "" {
+			m = WithSource(m, opts.Source)
+		}
+
+		m = SortManifest(m, opts.Sort)
+
+		writer := opts.Writer
+		if writer == nil {
+			writer = NewJSONManifestWriter(opts.CompactOutput)
 		}
 
-		if err != nil {
-			logger.Error("unable to convert output manifest to JSON", "errMsg", err)
+		if err := writer(out, m); err != nil {
+			logger.Error("unable to write output manifest", "errMsg", err)
 			return err
 		}
 
-		fmt.Fprintln(out, string(manifestJSON))
 		return nil
 	}
 }
 
-// processContainers produces DiscoveredImages for each container in the pod.
+// ManifestFromPods builds the Manifest of images used by pods, as the
+// processor returned by NewManifestJSONProcessorFn would. If envImagePattern is
+// not nil, images referenced by matching environment variables are included.
+func ManifestFromPods(pods []*corev1.Pod, envImagePattern *regexp.Regexp, logger *slog.Logger) discovery.Manifest {
+	m := discovery.Manifest{}
+	for _, p := range pods {
+		m = appendToManifest(m, processContainers(p, logger)...)
+		if envImagePattern != nil {
+			m = appendToManifest(m, processEnvReferences(p, envImagePattern, logger)...)
+		}
+	}
+
+	return m
+}
+
+// processContainers produces DiscoveredImages for each container and image
+// volume in the pod.
 func processContainers(
 	p *corev1.Pod,
 	logger *slog.Logger,
@@ -100,7 +218,7 @@ func processContainers(
 				Containers: []discovery.DiscoveredContainer{
 					{
 						Name: c.Name,
-						Type: discovery.ContainerTypeInit,
+						Type: initContainerType(c),
 						Pod: discovery.DiscoveredPod{
 							Name:      p.Name,
 							Namespace: p.Namespace,
@@ -131,9 +249,44 @@ func processContainers(
 		)
 	}
 
+	for _, v := range p.Spec.Volumes {
+		if v.Image == nil || v.Image.Reference == "" {
+			continue
+		}
+		logger.Debug("found an image volume", "name", v.Name, "pod", p.Name, "image", v.Image.Reference)
+		found = append(
+			found,
+			discovery.DiscoveredImage{
+				Image: v.Image.Reference,
+				Containers: []discovery.DiscoveredContainer{
+					{
+						Name:       v.Name,
+						Type:       discovery.ContainerTypeImageVolume,
+						PullPolicy: string(v.Image.PullPolicy),
+						Pod: discovery.DiscoveredPod{
+							Name:      p.Name,
+							Namespace: p.Namespace,
+						},
+					},
+				},
+			},
+		)
+	}
+
 	return found
 }
 
+// initContainerType returns ContainerTypeSidecar for native sidecars, init
+// containers which are restarted for the lifetime of the pod, and
+// ContainerTypeInit otherwise.
+func initContainerType(c corev1.Container) discovery.ContainerType {
+	if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+		return discovery.ContainerTypeSidecar
+	}
+
+	return discovery.ContainerTypeInit
+}
+
 func appendToManifest(m discovery.Manifest, images ...discovery.DiscoveredImage) discovery.Manifest {
 	for _, image := range images {
 		idx := slices.IndexFunc(m.DiscoveredImages, func(i discovery.DiscoveredImage) bool {
@@ -141,13 +294,25 @@ func appendToManifest(m discovery.Manifest, images ...discovery.DiscoveredImage)
 		})
 
 		if idx == -1 {
+			image.Containers = slices.Clone(image.Containers)
 			m.DiscoveredImages = append(m.DiscoveredImages, image)
 			continue
 		}
 
 		for _, container := range image.Containers {
-			if !slices.Contains(m.DiscoveredImages[idx].Containers, container) {
+			existing := slices.IndexFunc(m.DiscoveredImages[idx].Containers, func(c discovery.DiscoveredContainer) bool {
+				return keyOf(c) == keyOf(container)
+			})
+			if existing == -1 {
 				m.DiscoveredImages[idx].Containers = append(m.DiscoveredImages[idx].Containers, container)
+				continue
+			}
+
+			found := &m.DiscoveredImages[idx].Containers[existing]
+			for _, source := range container.Sources {
+				if !slices.Contains(found.Sources, source) {
+					found.Sources = append(slices.Clone(found.Sources), source)
+				}
 			}
 		}
 	}
@@ -155,6 +320,26 @@ func appendToManifest(m discovery.Manifest, images ...discovery.DiscoveredImage)
 	return m
 }
 
+// containerKey holds the fields of a DiscoveredContainer which identify it,
+// regardless of where it was observed. The platform is included, so that the
+// same pod running on nodes of different platforms, e.g. in clusters whose
+// manifests are merged, records each of them.
+type containerKey struct {
+	Name         string
+	Type         discovery.ContainerType
+	Pod          discovery.DiscoveredPod
+	ReferencedBy string
+	Platform     string
+}
+
+func keyOf(c discovery.DiscoveredContainer) containerKey {
+	return containerKey{Name: c.Name, Type: c.Type, Pod: c.Pod, ReferencedBy: c.ReferencedBy, Platform: c.Platform}
+}
+
+func containersEqual(c1, c2 discovery.DiscoveredContainer) bool {
+	return keyOf(c1) == keyOf(c2) && c1.PullPolicy == c2.PullPolicy && slices.Equal(c1.Sources, c2.Sources)
+}
+
 func imagesEqual(i1, i2 discovery.DiscoveredImage) bool {
-	return i1.Image == i2.Image && slices.Equal(i1.Containers, i2.Containers)
+	return i1.Image == i2.Image && slices.EqualFunc(i1.Containers, i2.Containers, containersEqual)
 }
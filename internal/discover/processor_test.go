@@ -536,6 +536,7 @@ func TestManifestJSONProcessorContextCancelled(t *testing.T) {
 
 func TestContainerProcessing(t *testing.T) {
 	t.Parallel()
+	restartPolicyAlways := corev1.ContainerRestartPolicyAlways
 	testcases := map[string]struct {
 		input    corev1.Pod
 		expected []discovery.DiscoveredImage
@@ -623,6 +624,71 @@ func TestContainerProcessing(t *testing.T) {
 				},
 			},
 		},
+		"native sidecar": {
+			input: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "sidecar-podname"},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{
+						{
+							Name:          "sidecar-cname",
+							Image:         "example.com/namespace/image:0.0.1",
+							RestartPolicy: &restartPolicyAlways,
+						},
+					},
+				},
+			},
+			expected: []discovery.DiscoveredImage{
+				{
+					Image: "example.com/namespace/image:0.0.1",
+					Containers: []discovery.DiscoveredContainer{
+						{
+							Name: "sidecar-cname",
+							Type: discovery.ContainerTypeSidecar,
+							Pod: discovery.DiscoveredPod{
+								Name: "sidecar-podname",
+							},
+						},
+					},
+				},
+			},
+		},
+		"image volumes only": {
+			input: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "vol-podname"},
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{
+						{
+							Name: "models",
+							VolumeSource: corev1.VolumeSource{
+								Image: &corev1.ImageVolumeSource{
+									Reference:  "example.com/namespace/artifact:0.0.1",
+									PullPolicy: corev1.PullIfNotPresent,
+								},
+							},
+						},
+						{
+							Name:         "scratch",
+							VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+						},
+					},
+				},
+			},
+			expected: []discovery.DiscoveredImage{
+				{
+					Image: "example.com/namespace/artifact:0.0.1",
+					Containers: []discovery.DiscoveredContainer{
+						{
+							Name:       "models",
+							Type:       discovery.ContainerTypeImageVolume,
+							PullPolicy: string(corev1.PullIfNotPresent),
+							Pod: discovery.DiscoveredPod{
+								Name: "vol-podname",
+							},
+						},
+					},
+				},
+			},
+		},
 		"all container types": {
 			input: corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{Name: "all-podname"},
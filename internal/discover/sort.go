@@ -0,0 +1,148 @@
+package discover
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+// SortOrder determines how a Manifest is ordered before it is written.
+type SortOrder = string
+
+const (
+	// SortByImage orders images by their normalized reference, and containers
+	// by namespace, pod, container name and container type. This is the
+	// default.
+	SortByImage SortOrder = "image"
+
+	// SortByNamespace groups images by the first namespace and pod they were
+	// discovered in. Containers are ordered as with SortByImage.
+	SortByNamespace SortOrder = "namespace"
+
+	// SortByType orders images as with SortByImage, but groups containers by
+	// their container type before namespace, pod and container name.
+	SortByType SortOrder = "type"
+
+	// SortByCategory groups images by their category, in the order of
+	// ImageCategories, and orders them as with SortByImage within each
+	// category. Uncategorized images come last.
+	SortByCategory SortOrder = "category"
+
+	// SortNone leaves the manifest in the order in which workloads were
+	// discovered.
+	SortNone SortOrder = "none"
+)
+
+// SortOrders lists all supported SortOrder values.
+var SortOrders = []SortOrder{SortByImage, SortByNamespace, SortByType, SortByCategory, SortNone}
+
+// ParseSortOrder validates s as a SortOrder. An empty value is treated as
+// SortByImage.
+func ParseSortOrder(s string) (SortOrder, error) {
+	if s == "" {
+		return SortByImage, nil
+	}
+
+	if !slices.Contains(SortOrders, s) {
+		return "", fmt.Errorf("unsupported sort order %q, must be one of %v", s, SortOrders)
+	}
+
+	return s, nil
+}
+
+// SortManifest returns a copy of m with its images and their containers placed
+// in a canonical order determined by order, so that repeated discovery runs
+// against the same workloads produce identical output. An empty order is
+// treated as SortByImage.
+func SortManifest(m discovery.Manifest, order SortOrder) discovery.Manifest {
+	if order == SortNone {
+		return m
+	}
+
+	compareContainers := compareContainersByLocation
+	if order == SortByType {
+		compareContainers = compareContainersByType
+	}
+
+	sorted := discovery.Manifest{
+		DiscoveredImages: make([]discovery.DiscoveredImage, 0, len(m.DiscoveredImages)),
+	}
+	for _, image := range m.DiscoveredImages {
+		image.Containers = slices.Clone(image.Containers)
+		slices.SortStableFunc(image.Containers, compareContainers)
+		sorted.DiscoveredImages = append(sorted.DiscoveredImages, image)
+	}
+
+	compareImages := compareImagesByReference
+	switch order {
+	case SortByNamespace:
+		compareImages = compareImagesByFirstPod
+	case SortByCategory:
+		compareImages = compareImagesByCategory
+	}
+	slices.SortStableFunc(sorted.DiscoveredImages, compareImages)
+
+	return sorted
+}
+
+func compareImagesByReference(a, b discovery.DiscoveredImage) int {
+	return cmp.Or(
+		cmp.Compare(imageref.Normalize(a.Image), imageref.Normalize(b.Image)),
+		cmp.Compare(a.Image, b.Image),
+	)
+}
+
+// compareImagesByFirstPod expects the containers of a and b to already be
+// sorted.
+func compareImagesByFirstPod(a, b discovery.DiscoveredImage) int {
+	if len(a.Containers) > 0 && len(b.Containers) > 0 {
+		if c := comparePods(a.Containers[0].Pod, b.Containers[0].Pod); c != 0 {
+			return c
+		}
+	}
+
+	return compareImagesByReference(a, b)
+}
+
+func compareImagesByCategory(a, b discovery.DiscoveredImage) int {
+	return cmp.Or(
+		cmp.Compare(categoryRank(a.Category), categoryRank(b.Category)),
+		compareImagesByReference(a, b),
+	)
+}
+
+func categoryRank(category discovery.ImageCategory) int {
+	if idx := slices.Index(ImageCategories, category); idx != -1 {
+		return idx
+	}
+
+	return len(ImageCategories)
+}
+
+func compareContainersByLocation(a, b discovery.DiscoveredContainer) int {
+	return cmp.Or(
+		comparePods(a.Pod, b.Pod),
+		cmp.Compare(a.Name, b.Name),
+		cmp.Compare(a.Type, b.Type),
+		cmp.Compare(a.ReferencedBy, b.ReferencedBy),
+	)
+}
+
+func compareContainersByType(a, b discovery.DiscoveredContainer) int {
+	return cmp.Or(
+		cmp.Compare(a.Type, b.Type),
+		comparePods(a.Pod, b.Pod),
+		cmp.Compare(a.Name, b.Name),
+		cmp.Compare(a.ReferencedBy, b.ReferencedBy),
+	)
+}
+
+func comparePods(a, b discovery.DiscoveredPod) int {
+	return cmp.Or(
+		cmp.Compare(a.Namespace, b.Namespace),
+		cmp.Compare(a.Name, b.Name),
+	)
+}
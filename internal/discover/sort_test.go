@@ -0,0 +1,138 @@
+package discover
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func TestSortManifest(t *testing.T) {
+	t.Parallel()
+	podA := discovery.DiscoveredPod{Name: "pod-a", Namespace: "ns-2"}
+	podB := discovery.DiscoveredPod{Name: "pod-b", Namespace: "ns-1"}
+	input := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{
+				Image: "quay.io/org/zeta:1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "z", Type: discovery.ContainerTypeStandard, Pod: podA},
+				},
+			},
+			{
+				Image: "busybox",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "b", Type: discovery.ContainerTypeStandard, Pod: podA},
+					{Name: "a", Type: discovery.ContainerTypeStandard, Pod: podA},
+					{Name: "c", Type: discovery.ContainerTypeInit, Pod: podB},
+				},
+			},
+			{
+				Image: "example.com/org/alpha:1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "x", Type: discovery.ContainerTypeStandard, Pod: podB},
+				},
+			},
+		},
+	}
+
+	testcases := map[string]struct {
+		order              SortOrder
+		expectedImages     []string
+		expectedContainers []string // of the busybox image
+	}{
+		"default": {
+			order:              "",
+			expectedImages:     []string{"busybox", "example.com/org/alpha:1", "quay.io/org/zeta:1"},
+			expectedContainers: []string{"c", "a", "b"},
+		},
+		"image": {
+			order:              SortByImage,
+			expectedImages:     []string{"busybox", "example.com/org/alpha:1", "quay.io/org/zeta:1"},
+			expectedContainers: []string{"c", "a", "b"},
+		},
+		"namespace": {
+			order:              SortByNamespace,
+			expectedImages:     []string{"busybox", "example.com/org/alpha:1", "quay.io/org/zeta:1"},
+			expectedContainers: []string{"c", "a", "b"},
+		},
+		"type": {
+			order:              SortByType,
+			expectedImages:     []string{"busybox", "example.com/org/alpha:1", "quay.io/org/zeta:1"},
+			expectedContainers: []string{"a", "b", "c"},
+		},
+		"none": {
+			order:              SortNone,
+			expectedImages:     []string{"quay.io/org/zeta:1", "busybox", "example.com/org/alpha:1"},
+			expectedContainers: []string{"b", "a", "c"},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			actual := SortManifest(input, tc.order)
+
+			images := make([]string, 0, len(actual.DiscoveredImages))
+			var containers []string
+			for _, image := range actual.DiscoveredImages {
+				images = append(images, image.Image)
+				if image.Image == "busybox" {
+					for _, c := range image.Containers {
+						containers = append(containers, c.Name)
+					}
+				}
+			}
+
+			if !slices.Equal(images, tc.expectedImages) {
+				t.Fatalf("SortManifest ordered images as %v; expected %v", images, tc.expectedImages)
+			}
+
+			if !slices.Equal(containers, tc.expectedContainers) {
+				t.Fatalf("SortManifest ordered containers as %v; expected %v", containers, tc.expectedContainers)
+			}
+		})
+	}
+
+	// The input must not be modified in place.
+	if input.DiscoveredImages[1].Containers[0].Name != "b" {
+		t.Fatalf("SortManifest modified the input manifest")
+	}
+}
+
+func TestSortManifestByNamespace(t *testing.T) {
+	t.Parallel()
+	input := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{
+				Image: "example.com/org/alpha:1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "a", Pod: discovery.DiscoveredPod{Name: "pod", Namespace: "ns-2"}},
+				},
+			},
+			{
+				Image: "example.com/org/beta:1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "b", Pod: discovery.DiscoveredPod{Name: "pod", Namespace: "ns-1"}},
+				},
+			},
+		},
+	}
+
+	actual := SortManifest(input, SortByNamespace)
+	if actual.DiscoveredImages[0].Image != "example.com/org/beta:1" {
+		t.Fatalf("SortManifest did not group images by namespace: %v", actual)
+	}
+}
+
+func TestParseSortOrder(t *testing.T) {
+	t.Parallel()
+	if _, err := ParseSortOrder("bogus"); err == nil {
+		t.Fatalf("ParseSortOrder accepted an unsupported value")
+	}
+
+	order, err := ParseSortOrder("")
+	if err != nil || order != SortByImage {
+		t.Fatalf("ParseSortOrder returned %q, %v; expected %q", order, err, SortByImage)
+	}
+}
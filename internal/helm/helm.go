@@ -0,0 +1,323 @@
+// Package helm discovers the images a Helm chart would deploy, by rendering
+// the chart locally without a cluster.
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/opdev/discover-workload/internal/discover"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+const (
+	// DefaultBinary is the helm executable used to render charts.
+	DefaultBinary = "helm"
+
+	// DefaultReleaseName is the release name charts are rendered with.
+	DefaultReleaseName = "release"
+
+	// DefaultNamespace is the namespace charts are rendered into.
+	DefaultNamespace = "default"
+
+	valuesFileName = "values.yaml"
+)
+
+// imageValueKeys are the values keys which usually configure images.
+var imageValueKeys = []string{"image", "repository", "tag"}
+
+// RenderOptions configure how a chart is rendered.
+type RenderOptions struct {
+	// Binary is the helm executable. DefaultBinary is used if it is empty.
+	Binary string
+
+	// ReleaseName is the name of the release. DefaultReleaseName is used if
+	// it is empty.
+	ReleaseName string
+
+	// Namespace is the namespace of the release, also applied to rendered
+	// objects which do not set one. DefaultNamespace is used if it is empty.
+	Namespace string
+
+	// ValuesFiles are passed to helm in order, so later files take
+	// precedence.
+	ValuesFiles []string
+}
+
+func (o RenderOptions) withDefaults() RenderOptions {
+	if o.Binary == "" {
+		o.Binary = DefaultBinary
+	}
+	if o.ReleaseName == "" {
+		o.ReleaseName = DefaultReleaseName
+	}
+	if o.Namespace == "" {
+		o.Namespace = DefaultNamespace
+	}
+
+	return o
+}
+
+// ImageValue is a values key which configures an image, e.g. image.tag.
+type ImageValue struct {
+	// Path is the dotted path of the key, e.g. ".image.tag".
+	Path string
+
+	// Value is the value of the key.
+	Value string
+}
+
+// Render runs helm template for the chart directory or archive at chartPath,
+// and returns the rendered manifests. No cluster is contacted.
+func Render(ctx context.Context, chartPath string, opts RenderOptions) ([]byte, error) {
+	opts = opts.withDefaults()
+	args := []string{"template", opts.ReleaseName, chartPath, "--namespace", opts.Namespace}
+	for _, valuesFile := range opts.ValuesFiles {
+		args = append(args, "--values", valuesFile)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, opts.Binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("unable to render chart %s: %w: %s", chartPath, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// ReadPodsFromChart renders the chart at chartPath and returns the pods its
+// workloads would create. Image keys in the chart's values, and in the values
+// files of opts, which none of the rendered pods use are logged as warnings.
+func ReadPodsFromChart(ctx context.Context, chartPath string, opts RenderOptions, logger *slog.Logger) ([]*corev1.Pod, error) {
+	opts = opts.withDefaults()
+	rendered, err := Render(ctx, chartPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := discover.DecodePods(bytes.NewReader(rendered), logger)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the rendered chart %s: %w", chartPath, err)
+	}
+	for _, p := range pods {
+		if p.Namespace == "" {
+			p.Namespace = opts.Namespace
+		}
+	}
+
+	values, err := ReadChartValues(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, valuesFile := range opts.ValuesFiles {
+		override, err := readValuesFile(valuesFile)
+		if err != nil {
+			return nil, err
+		}
+		values = mergeValues(values, override)
+	}
+
+	for _, unused := range UnusedImageValues(ImageValues(values), podImages(pods)) {
+		logger.Warn("image value is not used by the rendered chart", "key", unused.Path, "value", unused.Value)
+	}
+
+	return pods, nil
+}
+
+// ReadChartValues returns the default values of the chart directory or .tgz
+// archive at chartPath. Charts without a values.yaml have no values.
+func ReadChartValues(chartPath string) (map[string]any, error) {
+	info, err := os.Stat(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		values, err := readValuesFile(filepath.Join(chartPath, valuesFileName))
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]any{}, nil
+		}
+		return values, err
+	}
+
+	return readArchiveValues(chartPath)
+}
+
+func readArchiveValues(archivePath string) (map[string]any, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress %s: %w", archivePath, err)
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return map[string]any{}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", archivePath, err)
+		}
+
+		// Only the values of the chart itself, not of its dependencies in
+		// <chart>/charts/, are read.
+		dir, file := path.Split(path.Clean(header.Name))
+		if header.Typeflag != tar.TypeReg || file != valuesFileName || strings.Count(dir, "/") != 1 {
+			continue
+		}
+
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s in %s: %w", header.Name, archivePath, err)
+		}
+		return decodeValues(content, header.Name)
+	}
+}
+
+func readValuesFile(valuesPath string) (map[string]any, error) {
+	content, err := os.ReadFile(valuesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeValues(content, valuesPath)
+}
+
+func decodeValues(content []byte, name string) (map[string]any, error) {
+	values := map[string]any{}
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("unable to decode values %s: %w", name, err)
+	}
+
+	return values, nil
+}
+
+// mergeValues merges override into values, as helm does with values files.
+func mergeValues(values, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(values))
+	for key, value := range values {
+		merged[key] = value
+	}
+
+	for key, value := range override {
+		existing, isMap := merged[key].(map[string]any)
+		overrideMap, overrideIsMap := value.(map[string]any)
+		if isMap && overrideIsMap {
+			merged[key] = mergeValues(existing, overrideMap)
+			continue
+		}
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// ImageValues returns the image, repository, and tag keys in values which are
+// set to a non-empty string, ordered by path.
+func ImageValues(values map[string]any) []ImageValue {
+	var found []ImageValue
+	collectImageValues(values, "", &found)
+	slices.SortFunc(found, func(a, b ImageValue) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return found
+}
+
+func collectImageValues(value any, valuePath string, found *[]ImageValue) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			childPath := valuePath + "." + key
+			if s, isString := child.(string); isString && s != "" && slices.Contains(imageValueKeys, key) {
+				*found = append(*found, ImageValue{Path: childPath, Value: s})
+				continue
+			}
+			collectImageValues(child, childPath, found)
+		}
+	case []any:
+		for idx, child := range v {
+			collectImageValues(child, fmt.Sprintf("%s[%d]", valuePath, idx), found)
+		}
+	}
+}
+
+// UnusedImageValues returns the values which do not appear in any of images.
+// Tags are matched against the tag or digest of each image, and other values
+// against the whole reference.
+func UnusedImageValues(values []ImageValue, images []string) []ImageValue {
+	var unused []ImageValue
+	for _, value := range values {
+		used := slices.ContainsFunc(images, func(image string) bool {
+			if !strings.HasSuffix(value.Path, ".tag") {
+				return strings.Contains(image, value.Value) || strings.Contains(imageref.Normalize(image), value.Value)
+			}
+
+			ref, err := imageref.Parse(image)
+			return err == nil && (ref.Tag == value.Value || ref.Digest == value.Value)
+		})
+		if !used {
+			unused = append(unused, value)
+		}
+	}
+
+	return unused
+}
+
+// podImages returns the images of every container and image volume in pods,
+// and the values of the containers' environment variables, which may hold
+// image references too.
+func podImages(pods []*corev1.Pod) []string {
+	var images []string
+	addContainer := func(image string, env []corev1.EnvVar) {
+		images = append(images, image)
+		for _, e := range env {
+			if e.Value != "" {
+				images = append(images, e.Value)
+			}
+		}
+	}
+
+	for _, p := range pods {
+		for _, c := range p.Spec.InitContainers {
+			addContainer(c.Image, c.Env)
+		}
+		for _, c := range p.Spec.Containers {
+			addContainer(c.Image, c.Env)
+		}
+		for _, c := range p.Spec.EphemeralContainers {
+			addContainer(c.Image, c.Env)
+		}
+		for _, v := range p.Spec.Volumes {
+			if v.Image != nil {
+				images = append(images, v.Image.Reference)
+			}
+		}
+	}
+
+	return images
+}
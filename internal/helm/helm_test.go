@@ -0,0 +1,188 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testValues = `image:
+  repository: example.com/org/app
+  tag: "1.0"
+proxy:
+  image: example.com/org/proxy:2
+unusedSidecar:
+  image:
+    repository: example.com/org/sidecar
+    tag: ""
+`
+
+const testRendered = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: release-app
+spec:
+  selector: {}
+  template:
+    spec:
+      containers:
+      - name: app
+        image: example.com/org/app:1.0
+        env:
+        - name: PROXY_IMAGE
+          value: example.com/org/proxy:2
+---
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: release-app
+`
+
+// fakeHelm writes an executable which prints rendered, in place of helm, and
+// records the arguments it was run with to a file next to it.
+func fakeHelm(t *testing.T, rendered string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	renderedPath := filepath.Join(dir, "rendered.yaml")
+	if err := os.WriteFile(renderedPath, []byte(rendered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	argsPath := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$@\" > " + argsPath + "\ncat " + renderedPath + "\n"
+	binary := filepath.Join(dir, "helm")
+	if err := os.WriteFile(binary, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	return binary, argsPath
+}
+
+func TestReadPodsFromChart(t *testing.T) {
+	t.Parallel()
+	chartDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(chartDir, valuesFileName), []byte(testValues), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	overridePath := filepath.Join(t.TempDir(), "override.yaml")
+	if err := os.WriteFile(overridePath, []byte("debug:\n  image: example.com/org/debug:1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	binary, argsPath := fakeHelm(t, testRendered)
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, nil))
+
+	opts := RenderOptions{Binary: binary, Namespace: "apps", ValuesFiles: []string{overridePath}}
+	pods, err := ReadPodsFromChart(context.TODO(), chartDir, opts, logger)
+	if err != nil {
+		t.Fatalf("ReadPodsFromChart returned an unexpected error: %q", err)
+	}
+
+	if len(pods) != 1 || pods[0].Name != "release-app" || pods[0].Namespace != "apps" {
+		t.Fatalf("ReadPodsFromChart returned unexpected pods: %v", pods)
+	}
+
+	args, err := os.ReadFile(argsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedArgs := "template release " + chartDir + " --namespace apps --values " + overridePath + "\n"
+	if string(args) != expectedArgs {
+		t.Errorf("helm was run with %q; expected %q", args, expectedArgs)
+	}
+
+	for _, expected := range []string{"key=.unusedSidecar.image.repository", "key=.debug.image"} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("expected a warning for %s in the logs:\n%s", expected, logs.String())
+		}
+	}
+	if strings.Count(logs.String(), "image value is not used") != 2 {
+		t.Errorf("expected exactly two unused image values in the logs:\n%s", logs.String())
+	}
+}
+
+func TestRenderFailure(t *testing.T) {
+	t.Parallel()
+	binary := filepath.Join(t.TempDir(), "helm")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\necho 'Error: chart not found' >&2\nexit 1\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Render(context.TODO(), "missing", RenderOptions{Binary: binary})
+	if err == nil || !strings.Contains(err.Error(), "chart not found") {
+		t.Fatalf("Render returned %v; expected the helm error output", err)
+	}
+}
+
+func TestReadChartValuesFromArchive(t *testing.T) {
+	t.Parallel()
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	files := map[string]string{
+		"app/charts/dependency/values.yaml": "image: example.com/org/dependency:1\n",
+		"app/values.yaml":                   testValues,
+	}
+	for _, name := range []string{"app/charts/dependency/values.yaml", "app/values.yaml"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(files[name])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "app-0.1.0.tgz")
+	if err := os.WriteFile(archivePath, archive.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := ReadChartValues(archivePath)
+	if err != nil {
+		t.Fatalf("ReadChartValues returned an unexpected error: %q", err)
+	}
+
+	expected := []ImageValue{
+		{Path: ".image.repository", Value: "example.com/org/app"},
+		{Path: ".image.tag", Value: "1.0"},
+		{Path: ".proxy.image", Value: "example.com/org/proxy:2"},
+		{Path: ".unusedSidecar.image.repository", Value: "example.com/org/sidecar"},
+	}
+	if actual := ImageValues(values); !slices.Equal(actual, expected) {
+		t.Fatalf("ImageValues returned %v; expected %v", actual, expected)
+	}
+}
+
+func TestUnusedImageValues(t *testing.T) {
+	t.Parallel()
+	images := []string{"nginx:1.25", "example.com/org/app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"}
+	values := []ImageValue{
+		{Path: ".image.repository", Value: "library/nginx"},
+		{Path: ".image.tag", Value: "1.25"},
+		{Path: ".app.digest.tag", Value: "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+		{Path: ".other.tag", Value: "1.2"},
+	}
+
+	expected := []ImageValue{{Path: ".other.tag", Value: "1.2"}}
+	if actual := UnusedImageValues(values, images); !slices.Equal(actual, expected) {
+		t.Fatalf("UnusedImageValues returned %v; expected %v", actual, expected)
+	}
+}
@@ -0,0 +1,142 @@
+// Package imageref parses container image references into their registry,
+// repository, tag and digest components.
+package imageref
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultRegistry is the registry assumed for references that do not name
+	// one, matching the behavior of container runtimes.
+	DefaultRegistry = "docker.io"
+
+	// DefaultTag is the tag assumed for references with neither a tag nor a
+	// digest.
+	DefaultTag = "latest"
+
+	officialRepoPrefix = "library/"
+)
+
+var (
+	ErrEmptyReference   = errors.New("image reference is empty")
+	ErrInvalidReference = errors.New("invalid image reference")
+
+	repositoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagPattern        = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestPattern     = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+)
+
+// Reference is a parsed container image reference.
+type Reference struct {
+	// Registry is the registry host, including a port if one was provided.
+	Registry string
+
+	// Repository is the path of the image within the registry.
+	Repository string
+
+	// Tag is the image tag, if one was provided.
+	Tag string
+
+	// Digest is the content digest (e.g. sha256:...), if one was provided.
+	Digest string
+}
+
+// Parse parses s into a Reference. References without a registry are assumed
+// to be hosted on DefaultRegistry, and single-component repositories on that
+// registry are expanded to their "library/" form. No default tag is applied,
+// so that callers can tell whether one was provided.
+func Parse(s string) (Reference, error) {
+	if s == "" {
+		return Reference{}, ErrEmptyReference
+	}
+
+	ref := Reference{}
+	name := s
+	if before, after, found := strings.Cut(s, "@"); found {
+		if !digestPattern.MatchString(after) {
+			return Reference{}, fmt.Errorf("%w: %q has a malformed digest", ErrInvalidReference, s)
+		}
+		name, ref.Digest = before, after
+	}
+
+	if idx := strings.LastIndex(name, ":"); idx > strings.LastIndex(name, "/") {
+		ref.Tag = name[idx+1:]
+		name = name[:idx]
+		if !tagPattern.MatchString(ref.Tag) {
+			return Reference{}, fmt.Errorf("%w: %q has a malformed tag", ErrInvalidReference, s)
+		}
+	}
+
+	ref.Registry, ref.Repository = splitRegistry(name)
+	if !repositoryPattern.MatchString(ref.Repository) {
+		return Reference{}, fmt.Errorf("%w: %q has a malformed repository", ErrInvalidReference, s)
+	}
+
+	return ref, nil
+}
+
+// splitRegistry separates the registry host from the repository path in name.
+func splitRegistry(name string) (registry, repository string) {
+	first, rest, found := strings.Cut(name, "/")
+	if !found || !isRegistryHost(first) {
+		registry, repository = DefaultRegistry, name
+	} else {
+		registry, repository = first, rest
+	}
+
+	if registry == "index.docker.io" {
+		registry = DefaultRegistry
+	}
+
+	if registry == DefaultRegistry && !strings.Contains(repository, "/") {
+		repository = officialRepoPrefix + repository
+	}
+
+	return registry, repository
+}
+
+// isRegistryHost reports whether the first path component of a reference
+// names a registry rather than a repository namespace.
+func isRegistryHost(component string) bool {
+	return component == "localhost" ||
+		strings.ContainsAny(component, ".:") ||
+		strings.ToLower(component) != component
+}
+
+// Name returns the fully qualified repository name, without tag or digest.
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// String returns the fully qualified reference. DefaultTag is applied if the
+// reference has neither a tag nor a digest.
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag == "" && r.Digest == "" {
+		return s + ":" + DefaultTag
+	}
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+
+	return s
+}
+
+// Normalize returns the fully qualified form of the reference s. If s cannot be
+// parsed, it is returned unchanged so that callers can still use it as a stable
+// key.
+func Normalize(s string) string {
+	ref, err := Parse(s)
+	if err != nil {
+		return s
+	}
+
+	return ref.String()
+}
@@ -0,0 +1,98 @@
+package imageref
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	digest := "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	testcases := map[string]struct {
+		input      string
+		expected   Reference
+		normalized string
+	}{
+		"official image without tag": {
+			input:      "nginx",
+			expected:   Reference{Registry: "docker.io", Repository: "library/nginx"},
+			normalized: "docker.io/library/nginx:latest",
+		},
+		"docker hub namespace with tag": {
+			input:      "bitnami/redis:7.2",
+			expected:   Reference{Registry: "docker.io", Repository: "bitnami/redis", Tag: "7.2"},
+			normalized: "docker.io/bitnami/redis:7.2",
+		},
+		"legacy docker hub host": {
+			input:      "index.docker.io/busybox:1",
+			expected:   Reference{Registry: "docker.io", Repository: "library/busybox", Tag: "1"},
+			normalized: "docker.io/library/busybox:1",
+		},
+		"fully qualified with tag": {
+			input:      "registry.example.com/namespace/image:0.0.1",
+			expected:   Reference{Registry: "registry.example.com", Repository: "namespace/image", Tag: "0.0.1"},
+			normalized: "registry.example.com/namespace/image:0.0.1",
+		},
+		"registry with port and digest": {
+			input:      "localhost:5000/image@" + digest,
+			expected:   Reference{Registry: "localhost:5000", Repository: "image", Digest: digest},
+			normalized: "localhost:5000/image@" + digest,
+		},
+		"tag and digest": {
+			input:      "quay.io/org/image:v1@" + digest,
+			expected:   Reference{Registry: "quay.io", Repository: "org/image", Tag: "v1", Digest: digest},
+			normalized: "quay.io/org/image:v1@" + digest,
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			actual, err := Parse(tc.input)
+			if err != nil {
+				t.Fatalf("Parse returned an unexpected error: %q", err)
+			}
+
+			if actual != tc.expected {
+				t.Fatalf("Parse returned %+v; expected %+v", actual, tc.expected)
+			}
+
+			if actual.String() != tc.normalized {
+				t.Fatalf("String returned %q; expected %q", actual.String(), tc.normalized)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	t.Parallel()
+	testcases := map[string]struct {
+		input    string
+		expected error
+	}{
+		"empty":             {input: "", expected: ErrEmptyReference},
+		"uppercase repo":    {input: "example.com/Namespace/image:1", expected: ErrInvalidReference},
+		"malformed tag":     {input: "example.com/image:-bad", expected: ErrInvalidReference},
+		"malformed digest":  {input: "example.com/image@sha256:short", expected: ErrInvalidReference},
+		"trailing slash":    {input: "example.com/image/", expected: ErrInvalidReference},
+		"whitespace inside": {input: "example.com/my image", expected: ErrInvalidReference},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			_, err := Parse(tc.input)
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("Parse returned error %v; expected %v", err, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeUnparseable(t *testing.T) {
+	t.Parallel()
+	input := "not a valid reference"
+	if actual := Normalize(input); actual != input {
+		t.Fatalf("Normalize returned %q; expected the input to be returned unchanged", actual)
+	}
+}
@@ -0,0 +1,279 @@
+// Package mirror plans how discovered images are copied into a mirror
+// registry, and writes the plan in the formats of common mirroring tools.
+package mirror
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+const (
+	// imageSetConfigurationAPIVersion is the oc-mirror v2 API version.
+	imageSetConfigurationAPIVersion = "mirror.openshift.io/v2alpha1"
+	imageSetConfigurationKind       = "ImageSetConfiguration"
+)
+
+// RewriteRule places the repositories below Source at Target in the mirror
+// registry, instead of at their own path.
+type RewriteRule struct {
+	// Source is a registry or repository, e.g. "quay.io/my-org", which
+	// applies to every repository below it.
+	Source string `json:"source"`
+
+	// Target is the path under the mirror registry prefix at which the
+	// repositories below Source are placed. An empty Target places them
+	// directly under the prefix.
+	Target string `json:"target"`
+}
+
+// rewriteRulesFile is the shape of a rules file read by ReadRewriteRulesFile.
+type rewriteRulesFile struct {
+	Rules []RewriteRule `json:"rules"`
+}
+
+// ReadRewriteRulesFile decodes the YAML or JSON encoded rewrite rules stored at
+// path, in the form:
+//
+//	rules:
+//	- source: quay.io/my-org
+//	  target: products
+func ReadRewriteRulesFile(rulesPath string) ([]RewriteRule, error) {
+	content, err := os.ReadFile(rulesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := rewriteRulesFile{}
+	if err := yaml.UnmarshalStrict(content, &rules); err != nil {
+		return nil, fmt.Errorf("unable to decode rewrite rules %s: %w", rulesPath, err)
+	}
+
+	for idx, rule := range rules.Rules {
+		if rule.Source == "" {
+			return nil, fmt.Errorf("rewrite rule %d in %s is invalid: source is required", idx, rulesPath)
+		}
+	}
+
+	return rules.Rules, nil
+}
+
+// Plan describes where images are mirrored to.
+type Plan struct {
+	// Target is the registry, and optional path, which images are mirrored
+	// under, e.g. "mirror.example.com:5000/lab".
+	Target string
+
+	// Rules rewrite the path of the repositories they match. Otherwise a
+	// repository keeps its path, without its registry, under Target.
+	Rules []RewriteRule
+}
+
+// Mapping copies the image Source to Destination.
+type Mapping struct {
+	Source      string
+	Destination string
+}
+
+// SourceImages returns the distinct images to mirror for m, pinned to their
+// digest when one is known.
+func SourceImages(m discovery.Manifest) []string {
+	var images []string
+	for _, ref := range sources(m) {
+		if pinned := pinnedReference(ref); !slices.Contains(images, pinned) {
+			images = append(images, pinned)
+		}
+	}
+
+	return images
+}
+
+// sources returns the distinct references to mirror for m, in the order they
+// appear in m. Each image is mirrored from its origin, and records the digest
+// found by its registry inspection if the origin does not name one. Images
+// which cannot be parsed are skipped.
+func sources(m discovery.Manifest) []imageref.Reference {
+	var refs []imageref.Reference
+	for _, image := range m.DiscoveredImages {
+		ref, err := imageref.Parse(image.Origin())
+		if err != nil {
+			continue
+		}
+		if ref.Digest == "" && image.Inspection != nil && image.Inspection.Digest != "" {
+			ref.Digest = image.Inspection.Digest
+		}
+		if !slices.Contains(refs, ref) {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs
+}
+
+// pinnedReference returns ref without its tag if it names a digest.
+func pinnedReference(ref imageref.Reference) string {
+	if ref.Digest != "" {
+		ref.Tag = ""
+	}
+
+	return ref.String()
+}
+
+// Mappings returns the mapping of each image to mirror for m into the mirror
+// registry. Images are copied by digest when one is known, but keep their tag
+// in the mirror.
+func (p Plan) Mappings(m discovery.Manifest) ([]Mapping, error) {
+	if p.Target == "" {
+		return nil, errors.New("a mirror registry is required")
+	}
+
+	var mappings []Mapping
+	for _, ref := range sources(m) {
+		destination := p.Repository(ref.Name())
+		if ref.Tag != "" {
+			destination += ":" + ref.Tag
+		}
+		mapping := Mapping{Source: pinnedReference(ref), Destination: destination}
+		if !slices.Contains(mappings, mapping) {
+			mappings = append(mappings, mapping)
+		}
+	}
+
+	return mappings, nil
+}
+
+// Repository returns the repository in the mirror registry which the fully
+// qualified repository name is mirrored to. The most specific rule matching
+// name applies.
+func (p Plan) Repository(name string) string {
+	_, path, _ := strings.Cut(name, "/")
+	best := -1
+	for _, rule := range p.Rules {
+		rest, found := matchScope(rule.Source, name)
+		if !found || len(rule.Source) <= best {
+			continue
+		}
+		best = len(rule.Source)
+		path = strings.Trim(rule.Target+rest, "/")
+	}
+
+	return strings.TrimSuffix(p.Target, "/") + "/" + path
+}
+
+// matchScope reports whether name is scope or is below it, and returns the
+// rest of name after scope.
+func matchScope(scope, name string) (string, bool) {
+	scope = strings.TrimSuffix(scope, "/")
+	if name == scope {
+		return "", true
+	}
+	if rest, found := strings.CutPrefix(name, scope+"/"); found {
+		return "/" + rest, true
+	}
+
+	return "", false
+}
+
+// WriteMapping writes mappings as an `oc image mirror` mapping file, with one
+// source=destination line per image.
+func WriteMapping(out io.Writer, mappings []Mapping) error {
+	for _, mapping := range mappings {
+		if _, err := fmt.Fprintf(out, "%s=%s\n", mapping.Source, mapping.Destination); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// imageSetConfiguration is the oc-mirror configuration written by
+// WriteImageSetConfiguration.
+type imageSetConfiguration struct {
+	Kind       string `json:"kind"`
+	APIVersion string `json:"apiVersion"`
+	Mirror     struct {
+		AdditionalImages []additionalImage `json:"additionalImages"`
+	} `json:"mirror"`
+}
+
+type additionalImage struct {
+	Name string `json:"name"`
+}
+
+// WriteImageSetConfiguration writes an oc-mirror ImageSetConfiguration which
+// mirrors images as additionalImages. oc-mirror keeps the path of each
+// repository under the mirror registry given on its command line, so the
+// registry is only mentioned in a comment, when target is not empty.
+func WriteImageSetConfiguration(out io.Writer, images []string, target string) error {
+	config := imageSetConfiguration{Kind: imageSetConfigurationKind, APIVersion: imageSetConfigurationAPIVersion}
+	config.Mirror.AdditionalImages = make([]additionalImage, 0, len(images))
+	for _, image := range images {
+		config.Mirror.AdditionalImages = append(config.Mirror.AdditionalImages, additionalImage{Name: image})
+	}
+
+	if target != "" {
+		if _, err := fmt.Fprintf(out, "# oc-mirror --v2 -c <this file> --workspace file://<workspace> docker://%s\n", target); err != nil {
+			return err
+		}
+	}
+
+	return writeYAML(out, config)
+}
+
+// skopeoRegistry is the configuration of a source registry in a skopeo sync
+// file, listing the tags and digests of each repository to copy.
+type skopeoRegistry struct {
+	Images map[string][]string `json:"images"`
+}
+
+// WriteSkopeoSync writes a `skopeo sync --src yaml` file which copies images.
+// With --scoped, skopeo places each repository at its full name under the
+// destination given on its command line, so the registry is only mentioned in
+// a comment, when target is not empty.
+func WriteSkopeoSync(out io.Writer, images []string, target string) error {
+	registries := map[string]skopeoRegistry{}
+	for _, image := range images {
+		ref, err := imageref.Parse(image)
+		if err != nil {
+			return fmt.Errorf("unable to sync %s: %w", image, err)
+		}
+
+		registry, found := registries[ref.Registry]
+		if !found {
+			registry = skopeoRegistry{Images: map[string][]string{}}
+			registries[ref.Registry] = registry
+		}
+		// Images pinned to a digest are copied by digest.
+		version := cmp.Or(ref.Digest, ref.Tag, imageref.DefaultTag)
+		if !slices.Contains(registry.Images[ref.Repository], version) {
+			registry.Images[ref.Repository] = append(registry.Images[ref.Repository], version)
+		}
+	}
+
+	if target != "" {
+		if _, err := fmt.Fprintf(out, "# skopeo sync --all --scoped --src yaml --dest docker <this file> %s\n", target); err != nil {
+			return err
+		}
+	}
+
+	return writeYAML(out, registries)
+}
+
+func writeYAML(out io.Writer, v any) error {
+	content, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(content)
+	return err
+}
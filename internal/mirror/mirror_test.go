@@ -0,0 +1,153 @@
+package mirror
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+const (
+	digest      = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	otherDigest = "sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+)
+
+// testManifest holds images discovered by tag and by digest, one of which was
+// inspected, one pulled from a mirror, and one repeated.
+var testManifest = discovery.Manifest{DiscoveredImages: []discovery.DiscoveredImage{
+	{Image: "quay.io/my-org/operator:1.0", Inspection: &discovery.ImageInspection{Digest: digest}},
+	{Image: "quay.io/my-org/team/operand@" + digest},
+	{Image: "mirror.example.com/ubi9/ubi@" + otherDigest, CanonicalImage: "registry.redhat.io/ubi9/ubi@" + otherDigest},
+	{Image: "nginx:1.25"},
+	{Image: "docker.io/library/nginx:1.25"},
+}}
+
+func TestMappings(t *testing.T) {
+	t.Parallel()
+	rulesPath := filepath.Join(t.TempDir(), "rules.yaml")
+	rules := "rules:\n- source: quay.io/my-org\n  target: products\n- source: quay.io/my-org/team\n  target: \"\"\n- source: docker.io\n  target: hub\n"
+	if err := os.WriteFile(rulesPath, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	custom, err := ReadRewriteRulesFile(rulesPath)
+	if err != nil {
+		t.Fatalf("ReadRewriteRulesFile returned an unexpected error: %q", err)
+	}
+
+	testcases := map[string]struct {
+		plan     Plan
+		expected []Mapping
+	}{
+		"default paths": {
+			plan: Plan{Target: "mirror.lab:5000/"},
+			expected: []Mapping{
+				{Source: "quay.io/my-org/operator@" + digest, Destination: "mirror.lab:5000/my-org/operator:1.0"},
+				{Source: "quay.io/my-org/team/operand@" + digest, Destination: "mirror.lab:5000/my-org/team/operand"},
+				{Source: "registry.redhat.io/ubi9/ubi@" + otherDigest, Destination: "mirror.lab:5000/ubi9/ubi"},
+				{Source: "docker.io/library/nginx:1.25", Destination: "mirror.lab:5000/library/nginx:1.25"},
+			},
+		},
+		"rewritten paths": {
+			plan: Plan{Target: "mirror.lab:5000/lab", Rules: custom},
+			expected: []Mapping{
+				{Source: "quay.io/my-org/operator@" + digest, Destination: "mirror.lab:5000/lab/products/operator:1.0"},
+				{Source: "quay.io/my-org/team/operand@" + digest, Destination: "mirror.lab:5000/lab/operand"},
+				{Source: "registry.redhat.io/ubi9/ubi@" + otherDigest, Destination: "mirror.lab:5000/lab/ubi9/ubi"},
+				{Source: "docker.io/library/nginx:1.25", Destination: "mirror.lab:5000/lab/hub/library/nginx:1.25"},
+			},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			actual, err := tc.plan.Mappings(testManifest)
+			if err != nil {
+				t.Fatalf("Mappings returned an unexpected error: %q", err)
+			}
+			if !slices.Equal(actual, tc.expected) {
+				t.Fatalf("Mappings returned %v; expected %v", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestWriteMapping(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	mappings := []Mapping{{Source: "quay.io/my-org/operator@" + digest, Destination: "mirror.lab/my-org/operator:1.0"}}
+	if err := WriteMapping(&out, mappings); err != nil {
+		t.Fatalf("WriteMapping returned an unexpected error: %q", err)
+	}
+
+	expected := "quay.io/my-org/operator@" + digest + "=mirror.lab/my-org/operator:1.0\n"
+	if out.String() != expected {
+		t.Fatalf("WriteMapping wrote %q; expected %q", out.String(), expected)
+	}
+}
+
+func TestWriteImageSetConfiguration(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	if err := WriteImageSetConfiguration(&out, SourceImages(testManifest), "mirror.lab:5000"); err != nil {
+		t.Fatalf("WriteImageSetConfiguration returned an unexpected error: %q", err)
+	}
+	if !strings.HasPrefix(out.String(), "# oc-mirror") || !strings.Contains(out.String(), "docker://mirror.lab:5000") {
+		t.Fatalf("WriteImageSetConfiguration did not mention the mirror registry:\n%s", out.String())
+	}
+
+	config := imageSetConfiguration{}
+	if err := yaml.UnmarshalStrict(out.Bytes(), &config); err != nil {
+		t.Fatalf("WriteImageSetConfiguration wrote invalid YAML: %q", err)
+	}
+
+	var names []string
+	for _, image := range config.Mirror.AdditionalImages {
+		names = append(names, image.Name)
+	}
+	expected := []string{
+		"quay.io/my-org/operator@" + digest,
+		"quay.io/my-org/team/operand@" + digest,
+		"registry.redhat.io/ubi9/ubi@" + otherDigest,
+		"docker.io/library/nginx:1.25",
+	}
+	if config.Kind != imageSetConfigurationKind || config.APIVersion != imageSetConfigurationAPIVersion || !slices.Equal(names, expected) {
+		t.Fatalf("WriteImageSetConfiguration wrote %+v; expected additional images %v", config, expected)
+	}
+}
+
+func TestWriteSkopeoSync(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	if err := WriteSkopeoSync(&out, SourceImages(testManifest), ""); err != nil {
+		t.Fatalf("WriteSkopeoSync returned an unexpected error: %q", err)
+	}
+
+	registries := map[string]skopeoRegistry{}
+	if err := yaml.UnmarshalStrict(out.Bytes(), &registries); err != nil {
+		t.Fatalf("WriteSkopeoSync wrote invalid YAML: %q", err)
+	}
+
+	expected := map[string]map[string][]string{
+		"quay.io":            {"my-org/operator": {digest}, "my-org/team/operand": {digest}},
+		"registry.redhat.io": {"ubi9/ubi": {otherDigest}},
+		"docker.io":          {"library/nginx": {"1.25"}},
+	}
+	if len(registries) != len(expected) {
+		t.Fatalf("WriteSkopeoSync wrote %v; expected %v", registries, expected)
+	}
+	for registry, images := range expected {
+		for repository, versions := range images {
+			if !slices.Equal(registries[registry].Images[repository], versions) {
+				t.Errorf("WriteSkopeoSync wrote %v for %s/%s; expected %v", registries[registry].Images[repository], registry, repository, versions)
+			}
+		}
+	}
+}
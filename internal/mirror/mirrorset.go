@@ -0,0 +1,150 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+	"github.com/opdev/discover-workload/internal/openshift"
+)
+
+const (
+	// MirrorSetName is the name of the generated mirror sets.
+	MirrorSetName = "discover-workload"
+
+	mirrorSetAPIVersion = "config.openshift.io/v1"
+)
+
+// MirrorRules returns the mirror rules which redirect pulls of the images in m
+// to the mirror registry. Pulls by digest are redirected for every image and,
+// if tags is set, pulls by tag for the images referenced by tag. Repositories
+// are grouped under a common source, no broader than a registry namespace such
+// as "quay.io/my-org", whenever the mirror preserves their path below it.
+func (p Plan) MirrorRules(m discovery.Manifest, tags bool) (openshift.MirrorRules, error) {
+	if p.Target == "" {
+		return nil, errors.New("a mirror registry is required")
+	}
+
+	var byDigest, byTag []string
+	for _, image := range m.DiscoveredImages {
+		ref, err := imageref.Parse(image.Origin())
+		if err != nil {
+			continue
+		}
+		if !slices.Contains(byDigest, ref.Name()) {
+			byDigest = append(byDigest, ref.Name())
+		}
+		if ref.Digest == "" && !slices.Contains(byTag, ref.Name()) {
+			byTag = append(byTag, ref.Name())
+		}
+	}
+
+	rules := p.groupRepositories(byDigest, byDigest, false)
+	if tags {
+		rules = append(rules, p.groupRepositories(byTag, byDigest, true)...)
+	}
+
+	return rules, nil
+}
+
+// groupRepositories returns a rule for each group of repositories, sorted by
+// source. Each repository is covered by the broadest source under which every
+// one of all, the discovered repositories, keeps its path in the mirror.
+func (p Plan) groupRepositories(repositories, all []string, tags bool) openshift.MirrorRules {
+	var rules openshift.MirrorRules
+	for _, repository := range repositories {
+		source, mirror := p.broadestSource(repository, all)
+		rule := openshift.MirrorRule{Source: source, Mirrors: []string{mirror}, Tags: tags}
+		if !slices.ContainsFunc(rules, func(r openshift.MirrorRule) bool { return r.Source == source }) {
+			rules = append(rules, rule)
+		}
+	}
+
+	slices.SortFunc(rules, func(a, b openshift.MirrorRule) int {
+		return strings.Compare(a.Source, b.Source)
+	})
+
+	return rules
+}
+
+// broadestSource returns the broadest parent of repository, or repository
+// itself, under which every one of repositories is mirrored with the same
+// path, and the repository it is mirrored to.
+func (p Plan) broadestSource(repository string, repositories []string) (string, string) {
+	target := strings.TrimSuffix(p.Target, "/")
+	source, mirror := repository, p.Repository(repository)
+	for {
+		parent, parentMirror := path.Dir(source), path.Dir(mirror)
+		// Sources are no broader than a namespace of a registry, and their
+		// mirror must remain below the mirror registry.
+		if !strings.Contains(parent, "/") || path.Base(source) != path.Base(mirror) ||
+			(parentMirror != target && !strings.HasPrefix(parentMirror, target+"/")) {
+			return source, mirror
+		}
+
+		consistent := !slices.ContainsFunc(repositories, func(r string) bool {
+			rest, found := matchScope(parent, r)
+			return found && p.Repository(r) != parentMirror+rest
+		})
+		if !consistent {
+			return source, mirror
+		}
+
+		source, mirror = parent, parentMirror
+	}
+}
+
+// mirrorSetObject is an ImageDigestMirrorSet or ImageTagMirrorSet written by
+// WriteMirrorSets.
+type mirrorSetObject struct {
+	metav1.TypeMeta `json:",inline"`
+	Metadata        struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		ImageDigestMirrors []imageMirrors `json:"imageDigestMirrors,omitempty"`
+		ImageTagMirrors    []imageMirrors `json:"imageTagMirrors,omitempty"`
+	} `json:"spec"`
+}
+
+type imageMirrors struct {
+	Source  string   `json:"source"`
+	Mirrors []string `json:"mirrors"`
+}
+
+// WriteMirrorSets writes rules as an ImageDigestMirrorSet named name, followed
+// by an ImageTagMirrorSet if any rule applies to tags.
+func WriteMirrorSets(out io.Writer, rules openshift.MirrorRules, name string) error {
+	digestSet := mirrorSetObject{TypeMeta: metav1.TypeMeta{APIVersion: mirrorSetAPIVersion, Kind: openshift.ImageDigestMirrorSetKind}}
+	digestSet.Metadata.Name = name
+	tagSet := mirrorSetObject{TypeMeta: metav1.TypeMeta{APIVersion: mirrorSetAPIVersion, Kind: openshift.ImageTagMirrorSetKind}}
+	tagSet.Metadata.Name = name
+	for _, rule := range rules {
+		entry := imageMirrors{Source: rule.Source, Mirrors: rule.Mirrors}
+		if rule.Tags {
+			tagSet.Spec.ImageTagMirrors = append(tagSet.Spec.ImageTagMirrors, entry)
+		} else {
+			digestSet.Spec.ImageDigestMirrors = append(digestSet.Spec.ImageDigestMirrors, entry)
+		}
+	}
+
+	if err := writeYAML(out, digestSet); err != nil {
+		return err
+	}
+	if len(tagSet.Spec.ImageTagMirrors) == 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprintln(out, "---"); err != nil {
+		return err
+	}
+
+	return writeYAML(out, tagSet)
+}
@@ -0,0 +1,98 @@
+package mirror
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+	"github.com/opdev/discover-workload/internal/openshift"
+)
+
+func TestMirrorRules(t *testing.T) {
+	t.Parallel()
+	m := discovery.Manifest{DiscoveredImages: slices.Concat(testManifest.DiscoveredImages, []discovery.DiscoveredImage{
+		{Image: "quay.io/my-org/console@" + digest},
+		{Image: "quay.io/partner/app:2"},
+		{Image: "quay.io/partner/db@" + digest},
+	})}
+	plan := Plan{Target: "mirror.lab:5000/lab", Rules: []RewriteRule{{Source: "quay.io/partner/db", Target: "databases/db"}}}
+
+	rules, err := plan.MirrorRules(m, true)
+	if err != nil {
+		t.Fatalf("MirrorRules returned an unexpected error: %q", err)
+	}
+
+	expected := openshift.MirrorRules{
+		{Source: "docker.io/library", Mirrors: []string{"mirror.lab:5000/lab/library"}},
+		{Source: "quay.io/my-org", Mirrors: []string{"mirror.lab:5000/lab/my-org"}},
+		{Source: "quay.io/partner/app", Mirrors: []string{"mirror.lab:5000/lab/partner/app"}},
+		{Source: "quay.io/partner/db", Mirrors: []string{"mirror.lab:5000/lab/databases/db"}},
+		{Source: "registry.redhat.io/ubi9", Mirrors: []string{"mirror.lab:5000/lab/ubi9"}},
+		{Source: "docker.io/library", Mirrors: []string{"mirror.lab:5000/lab/library"}, Tags: true},
+		{Source: "quay.io/my-org", Mirrors: []string{"mirror.lab:5000/lab/my-org"}, Tags: true},
+		{Source: "quay.io/partner/app", Mirrors: []string{"mirror.lab:5000/lab/partner/app"}, Tags: true},
+	}
+	if !slices.EqualFunc(rules, expected, func(r1, r2 openshift.MirrorRule) bool {
+		return r1.Source == r2.Source && slices.Equal(r1.Mirrors, r2.Mirrors) && r1.Tags == r2.Tags
+	}) {
+		t.Fatalf("MirrorRules returned %v; expected %v", rules, expected)
+	}
+
+	var out bytes.Buffer
+	if err := WriteMirrorSets(&out, rules, MirrorSetName); err != nil {
+		t.Fatalf("WriteMirrorSets returned an unexpected error: %q", err)
+	}
+	written, err := openshift.DecodeMirrorRules(&out)
+	if err != nil {
+		t.Fatalf("WriteMirrorSets wrote mirror sets which cannot be decoded: %q", err)
+	}
+
+	// Every image is redirected to where it is mirrored to.
+	mappings, err := plan.Mappings(m)
+	if err != nil {
+		t.Fatalf("Mappings returned an unexpected error: %q", err)
+	}
+	for _, mapping := range mappings {
+		ref, err := imageref.Parse(mapping.Source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		destination, err := imageref.Parse(mapping.Destination)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mirrored := ref
+		mirrored.Registry, mirrored.Repository = destination.Registry, destination.Repository
+
+		_, mirrors := written.Resolve(mapping.Source)
+		if !slices.Equal(mirrors, []string{mirrored.String()}) {
+			t.Errorf("the mirror sets redirect %s to %v; expected %s", mapping.Source, mirrors, mirrored.String())
+		}
+	}
+}
+
+func TestWriteMirrorSetsWithoutTags(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	rules := openshift.MirrorRules{{Source: "quay.io/my-org", Mirrors: []string{"mirror.lab/my-org"}}}
+	if err := WriteMirrorSets(&out, rules, MirrorSetName); err != nil {
+		t.Fatalf("WriteMirrorSets returned an unexpected error: %q", err)
+	}
+
+	expected := `apiVersion: config.openshift.io/v1
+kind: ImageDigestMirrorSet
+metadata:
+  name: discover-workload
+spec:
+  imageDigestMirrors:
+  - mirrors:
+    - mirror.lab/my-org
+    source: quay.io/my-org
+`
+	if out.String() != expected {
+		t.Fatalf("WriteMirrorSets wrote:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
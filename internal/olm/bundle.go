@@ -0,0 +1,267 @@
+package olm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/discover"
+)
+
+const (
+	// RelatedImagesReference is the ReferencedBy value of images declared in
+	// the relatedImages of a ClusterServiceVersion or catalog bundle.
+	RelatedImagesReference = "relatedImages"
+
+	// BundleImageReference is the ReferencedBy value of bundle images listed
+	// in a file-based catalog.
+	BundleImageReference = "olm.bundle"
+
+	// bundleSchema is the schema of the file-based catalog objects which
+	// describe a bundle.
+	bundleSchema = "olm.bundle"
+
+	// bundleObjectProperty is the type of the properties of a catalog bundle
+	// which embed one of the bundle's manifests, such as its CSV.
+	bundleObjectProperty = "olm.bundle.object"
+
+	// csvMetadataProperty is the type of the property which catalogs may
+	// hold instead of the bundle's CSV. It carries the CSV's metadata, but
+	// not its deployments, so it declares no images.
+	csvMetadataProperty = "olm.csv.metadata"
+
+	// clusterServiceVersionKind is the kind of ClusterServiceVersions.
+	clusterServiceVersionKind = "ClusterServiceVersion"
+
+	// bundleManifestsDir is the directory of a bundle holding its CSV.
+	bundleManifestsDir = "manifests"
+)
+
+// ErrNoClusterServiceVersion is returned when a bundle does not contain a
+// ClusterServiceVersion.
+var ErrNoClusterServiceVersion = errors.New("no ClusterServiceVersion found in the bundle")
+
+// catalogBundle holds the parts of a file-based catalog olm.bundle object
+// which declare images.
+type catalogBundle struct {
+	Schema        string            `json:"schema"`
+	Name          string            `json:"name"`
+	Image         string            `json:"image"`
+	RelatedImages []RelatedImage    `json:"relatedImages"`
+	Properties    []catalogProperty `json:"properties"`
+}
+
+// catalogProperty is a property of a catalog bundle. The shape of its value
+// depends on its type.
+type catalogProperty struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// bundleObject is the value of an olm.bundle.object property. Data holds the
+// manifest, which is base64-encoded in the catalog.
+type bundleObject struct {
+	Data []byte `json:"data"`
+}
+
+// ReadManifestFromPath returns the images declared by the operator bundle or
+// file-based catalog in the directory dir. Directories with a
+// manifests/*.clusterserviceversion.* file are read as bundles, and any other
+// directory as a catalog.
+func ReadManifestFromPath(dir string, envImagePattern *regexp.Regexp, logger *slog.Logger) (discovery.Manifest, error) {
+	csvPath, err := findBundleClusterServiceVersion(dir)
+	switch {
+	case err == nil:
+		csv, err := ReadClusterServiceVersionFile(csvPath)
+		if err != nil {
+			return discovery.Manifest{}, err
+		}
+		return ManifestFromClusterServiceVersion(csv, envImagePattern, logger), nil
+	case errors.Is(err, ErrNoClusterServiceVersion):
+		return ReadCatalogManifest(dir, envImagePattern, logger)
+	default:
+		return discovery.Manifest{}, err
+	}
+}
+
+func findBundleClusterServiceVersion(dir string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, bundleManifestsDir, "*.clusterserviceversion.*"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", ErrNoClusterServiceVersion
+	}
+	if len(matches) > 1 {
+		return "", fmt.Errorf("bundle %s contains more than one ClusterServiceVersion: %v", dir, matches)
+	}
+
+	return matches[0], nil
+}
+
+// ManifestFromClusterServiceVersion returns the images declared by csv: those
+// of the containers in its deployments, the values of their environment
+// variables matching envImagePattern, and its relatedImages. Containers are
+// reported in a pod named after their deployment, and related images under
+// the name of the CSV.
+func ManifestFromClusterServiceVersion(csv ClusterServiceVersion, envImagePattern *regexp.Regexp, logger *slog.Logger) discovery.Manifest {
+	pods := make([]*corev1.Pod, 0, len(csv.Spec.Install.Spec.Deployments))
+	for _, deployment := range csv.Spec.Install.Spec.Deployments {
+		p := &corev1.Pod{
+			ObjectMeta: *deployment.Spec.Template.ObjectMeta.DeepCopy(),
+			Spec:       *deployment.Spec.Template.Spec.DeepCopy(),
+		}
+		p.Name = deployment.Name
+		p.Namespace = csv.Namespace
+		pods = append(pods, p)
+	}
+
+	m := discover.ManifestFromPods(pods, envImagePattern, logger)
+	return discover.MergeManifests(m, relatedImagesManifest(csv.Name, csv.Namespace, csv.Spec.RelatedImages))
+}
+
+// ReadCatalogManifest returns the bundle images and relatedImages of every
+// olm.bundle in the file-based catalog in the directory dir. Each image is
+// reported under the name of the bundle declaring it. The CSVs embedded in
+// olm.bundle.object properties are read as ManifestFromClusterServiceVersion
+// does, adding the images of their deployments and of the environment
+// variables matching envImagePattern.
+func ReadCatalogManifest(dir string, envImagePattern *regexp.Regexp, logger *slog.Logger) (discovery.Manifest, error) {
+	m := discovery.Manifest{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if d.IsDir() || (ext != ".json" && ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+
+		bundles, err := readCatalogBundles(p)
+		if err != nil {
+			return err
+		}
+		for _, bundle := range bundles {
+			logger.Debug("found a catalog bundle", "name", bundle.Name, "path", p)
+			found, err := catalogBundleManifest(bundle, envImagePattern, logger)
+			if err != nil {
+				return fmt.Errorf("unable to read bundle %s in catalog %s: %w", bundle.Name, p, err)
+			}
+			m = discover.MergeManifests(m, found)
+		}
+		return nil
+	})
+	if err != nil {
+		return discovery.Manifest{}, err
+	}
+
+	return m, nil
+}
+
+func readCatalogBundles(catalogPath string) ([]catalogBundle, error) {
+	f, err := os.Open(catalogPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var bundles []catalogBundle
+	decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		obj := catalogBundle{}
+		err := decoder.Decode(&obj)
+		if errors.Is(err, io.EOF) {
+			return bundles, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode catalog %s: %w", catalogPath, err)
+		}
+
+		if obj.Schema == bundleSchema {
+			bundles = append(bundles, obj)
+		}
+	}
+}
+
+func catalogBundleManifest(bundle catalogBundle, envImagePattern *regexp.Regexp, logger *slog.Logger) (discovery.Manifest, error) {
+	m := relatedImagesManifest(bundle.Name, "", bundle.RelatedImages)
+	for _, property := range bundle.Properties {
+		switch property.Type {
+		case bundleObjectProperty:
+			csv, found, err := decodeBundleObjectCSV(property.Value)
+			if err != nil {
+				return discovery.Manifest{}, err
+			}
+			if found {
+				m = discover.MergeManifests(m, ManifestFromClusterServiceVersion(csv, envImagePattern, logger))
+			}
+		case csvMetadataProperty:
+			logger.Debug("catalog bundle only holds the metadata of its CSV, so its deployments are unknown", "name", bundle.Name)
+		}
+	}
+
+	if bundle.Image == "" {
+		return m, nil
+	}
+
+	return discover.MergeManifests(m, discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{{
+			Image: bundle.Image,
+			Containers: []discovery.DiscoveredContainer{{
+				Name:         bundle.Name,
+				ReferencedBy: BundleImageReference,
+				Pod:          discovery.DiscoveredPod{Name: bundle.Name},
+			}},
+		}},
+	}), nil
+}
+
+// decodeBundleObjectCSV decodes the manifest embedded in the value of an
+// olm.bundle.object property. found is false if it is not a
+// ClusterServiceVersion, e.g. a CustomResourceDefinition.
+func decodeBundleObjectCSV(value json.RawMessage) (csv ClusterServiceVersion, found bool, err error) {
+	obj := bundleObject{}
+	if err := json.Unmarshal(value, &obj); err != nil {
+		return csv, false, fmt.Errorf("unable to decode %s property: %w", bundleObjectProperty, err)
+	}
+
+	if err := yaml.Unmarshal(obj.Data, &csv); err != nil {
+		return csv, false, fmt.Errorf("unable to decode the manifest of a %s property: %w", bundleObjectProperty, err)
+	}
+
+	return csv, csv.Kind == clusterServiceVersionKind, nil
+}
+
+// relatedImagesManifest reports each of related under a pod named owner.
+func relatedImagesManifest(owner, namespace string, related []RelatedImage) discovery.Manifest {
+	m := discovery.Manifest{}
+	for _, r := range related {
+		if r.Image == "" {
+			continue
+		}
+		m = discover.MergeManifests(m, discovery.Manifest{
+			DiscoveredImages: []discovery.DiscoveredImage{{
+				Image: r.Image,
+				Containers: []discovery.DiscoveredContainer{{
+					Name:         r.Name,
+					ReferencedBy: RelatedImagesReference,
+					Pod:          discovery.DiscoveredPod{Name: owner, Namespace: namespace},
+				}},
+			}},
+		})
+	}
+
+	return m
+}
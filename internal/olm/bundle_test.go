@@ -0,0 +1,142 @@
+package olm
+
+import (
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+const testBundleCSV = `apiVersion: operators.coreos.com/v1alpha1
+kind: ClusterServiceVersion
+metadata:
+  name: operator.v1.0.0
+spec:
+  relatedImages:
+  - name: db
+    image: example.com/org/db:1
+  install:
+    strategy: deployment
+    spec:
+      deployments:
+      - name: operator-controller
+        spec:
+          selector: {}
+          template:
+            spec:
+              containers:
+              - name: manager
+                image: example.com/org/operator:1
+                env:
+                - name: RELATED_IMAGE_PROXY
+                  value: example.com/org/proxy:1
+`
+
+// testCatalog is a file-based catalog whose bundle embeds testBundleCSV, in
+// which the proxy image is only referenced by an environment variable, and a
+// CRD, which declares no images.
+var testCatalog = `{
+    "schema": "olm.package",
+    "name": "operator"
+}
+{
+    "schema": "olm.bundle",
+    "name": "operator.v1.0.0",
+    "package": "operator",
+    "image": "example.com/org/operator-bundle:1",
+    "properties": [
+        {"type": "olm.package", "value": {"packageName": "operator", "version": "1.0.0"}},
+        {"type": "olm.bundle.object", "value": {"data": "` + base64.StdEncoding.EncodeToString([]byte(testBundleCSV)) + `"}},
+        {"type": "olm.bundle.object", "value": {"data": "` + base64.StdEncoding.EncodeToString([]byte(testCRD)) + `"}}
+    ],
+    "relatedImages": [
+        {"name": "", "image": "example.com/org/operator-bundle:1"},
+        {"name": "db", "image": "example.com/org/db:1"}
+    ]
+}
+`
+
+const testCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: memcacheds.cache.example.com
+spec:
+  group: cache.example.com
+`
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func manifestReferences(m discovery.Manifest) []string {
+	var refs []string
+	for _, image := range m.DiscoveredImages {
+		for _, c := range image.Containers {
+			refs = append(refs, image.Image+" "+c.Pod.Name+"/"+c.Name+" "+c.ReferencedBy)
+		}
+	}
+	slices.Sort(refs)
+
+	return refs
+}
+
+func TestReadManifestFromPath(t *testing.T) {
+	t.Parallel()
+	bundleDir := t.TempDir()
+	writeTestFile(t, filepath.Join(bundleDir, bundleManifestsDir, "operator.clusterserviceversion.yaml"), testBundleCSV)
+	writeTestFile(t, filepath.Join(bundleDir, "metadata", "annotations.yaml"), "annotations: {}\n")
+
+	catalogDir := t.TempDir()
+	writeTestFile(t, filepath.Join(catalogDir, "operator", "catalog.json"), testCatalog)
+
+	testcases := map[string]struct {
+		dir      string
+		expected []string
+	}{
+		"bundle": {
+			dir: bundleDir,
+			expected: []string{
+				"example.com/org/db:1 operator.v1.0.0/db relatedImages",
+				"example.com/org/operator:1 operator-controller/manager ",
+				"example.com/org/proxy:1 operator-controller/manager env:RELATED_IMAGE_PROXY",
+			},
+		},
+		"file-based catalog": {
+			dir: catalogDir,
+			expected: []string{
+				"example.com/org/db:1 operator.v1.0.0/db relatedImages",
+				"example.com/org/operator-bundle:1 operator.v1.0.0/ relatedImages",
+				"example.com/org/operator-bundle:1 operator.v1.0.0/operator.v1.0.0 olm.bundle",
+				"example.com/org/operator:1 operator-controller/manager ",
+				"example.com/org/proxy:1 operator-controller/manager env:RELATED_IMAGE_PROXY",
+			},
+		},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			m, err := ReadManifestFromPath(tc.dir, regexp.MustCompile("^RELATED_IMAGE_"), logger)
+			if err != nil {
+				t.Fatalf("ReadManifestFromPath returned an unexpected error: %q", err)
+			}
+
+			if actual := manifestReferences(m); !slices.Equal(actual, tc.expected) {
+				t.Fatalf("ReadManifestFromPath found %q; expected %q", actual, tc.expected)
+			}
+		})
+	}
+}
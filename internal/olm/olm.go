@@ -0,0 +1,264 @@
+// Package olm reads the Operator Lifecycle Manager (OLM) resources which
+// describe the images an operator declares, and compares them with the images
+// that were discovered.
+package olm
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+const (
+	// CopiedFromLabel is set by OLM on the copies of a ClusterServiceVersion
+	// it places in each of the operator's target namespaces. Its value is the
+	// namespace of the original.
+	CopiedFromLabel = "olm.copiedFrom"
+
+	// relatedImageEnvPrefix is the conventional prefix of environment
+	// variables which advertise operand images.
+	relatedImageEnvPrefix = "RELATED_IMAGE_"
+)
+
+// ClusterServiceVersionGVR identifies ClusterServiceVersions for the dynamic
+// client.
+var ClusterServiceVersionGVR = schema.GroupVersionResource{
+	Group:    "operators.coreos.com",
+	Version:  "v1alpha1",
+	Resource: "clusterserviceversions",
+}
+
+// ClusterServiceVersion holds the parts of an OLM ClusterServiceVersion which
+// declare images.
+type ClusterServiceVersion struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterServiceVersionSpec `json:"spec"`
+}
+
+// ClusterServiceVersionSpec holds the parts of a ClusterServiceVersion's spec
+// which declare images.
+type ClusterServiceVersionSpec struct {
+	Install                   InstallStrategy           `json:"install"`
+	RelatedImages             []RelatedImage            `json:"relatedImages,omitempty"`
+	CustomResourceDefinitions CustomResourceDefinitions `json:"customresourcedefinitions,omitempty"`
+}
+
+// CustomResourceDefinitions lists the CRDs the operator provides.
+type CustomResourceDefinitions struct {
+	Owned []CRDDescription `json:"owned,omitempty"`
+}
+
+// CRDDescription describes a CRD the operator provides, by its name, e.g.
+// memcacheds.cache.example.com, and the version served to its users.
+type CRDDescription struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// InstallStrategy describes how OLM installs the operator.
+type InstallStrategy struct {
+	Spec InstallStrategySpec `json:"spec,omitempty"`
+}
+
+// InstallStrategySpec lists the deployments OLM creates for the operator.
+type InstallStrategySpec struct {
+	Deployments []StrategyDeploymentSpec `json:"deployments"`
+}
+
+// StrategyDeploymentSpec is a deployment created by OLM for the operator.
+type StrategyDeploymentSpec struct {
+	Name string                `json:"name"`
+	Spec appsv1.DeploymentSpec `json:"spec"`
+}
+
+// RelatedImage is an image the operator declares that it uses.
+type RelatedImage struct {
+	Name  string `json:"name,omitempty"`
+	Image string `json:"image"`
+}
+
+// FromUnstructured converts obj into a ClusterServiceVersion.
+func FromUnstructured(obj *unstructured.Unstructured) (ClusterServiceVersion, error) {
+	csv := ClusterServiceVersion{}
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &csv)
+	return csv, err
+}
+
+// FindClusterServiceVersions returns the ClusterServiceVersions of the
+// operators installed in, or targeting, namespaces. When OLM copied a
+// ClusterServiceVersion into a namespace, the original is returned instead.
+// Each ClusterServiceVersion is returned at most once.
+func FindClusterServiceVersions(ctx context.Context, client dynamic.Interface, namespaces []string) ([]ClusterServiceVersion, error) {
+	var found []ClusterServiceVersion
+	seen := map[string]bool{}
+	for _, ns := range namespaces {
+		list, err := client.Resource(ClusterServiceVersionGVR).Namespace(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if origin, copied := obj.GetLabels()[CopiedFromLabel]; copied && origin != ns {
+				obj, err = client.Resource(ClusterServiceVersionGVR).Namespace(origin).Get(ctx, obj.GetName(), metav1.GetOptions{})
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			key := obj.GetNamespace() + "/" + obj.GetName()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			csv, err := FromUnstructured(obj)
+			if err != nil {
+				return nil, err
+			}
+			found = append(found, csv)
+		}
+	}
+
+	return found, nil
+}
+
+// OwnedResources returns the resources of the CRDs owned by csvs. Each
+// resource is returned at most once.
+func OwnedResources(csvs []ClusterServiceVersion) []schema.GroupVersionResource {
+	var gvrs []schema.GroupVersionResource
+	for _, csv := range csvs {
+		for _, crd := range csv.Spec.CustomResourceDefinitions.Owned {
+			resource, group, found := strings.Cut(crd.Name, ".")
+			if !found || crd.Version == "" {
+				continue
+			}
+
+			gvr := schema.GroupVersionResource{Group: group, Version: crd.Version, Resource: resource}
+			if !slices.Contains(gvrs, gvr) {
+				gvrs = append(gvrs, gvr)
+			}
+		}
+	}
+
+	return gvrs
+}
+
+// DeclaredImages returns every image csv declares: its related images, the
+// images of the containers and image volumes in its deployments, and the
+// values of their RELATED_IMAGE_ environment variables. Duplicates are removed.
+func (csv ClusterServiceVersion) DeclaredImages() []string {
+	var images []string
+	add := func(image string) {
+		if image != "" && !slices.Contains(images, image) {
+			images = append(images, image)
+		}
+	}
+
+	for _, related := range csv.Spec.RelatedImages {
+		add(related.Image)
+	}
+
+	for _, deployment := range csv.Spec.Install.Spec.Deployments {
+		podSpec := deployment.Spec.Template.Spec
+		for _, c := range slices.Concat(podSpec.InitContainers, podSpec.Containers) {
+			add(c.Image)
+			for _, e := range c.Env {
+				if isRelatedImageEnv(e) {
+					add(e.Value)
+				}
+			}
+		}
+		for _, v := range podSpec.Volumes {
+			if v.Image != nil {
+				add(v.Image.Reference)
+			}
+		}
+	}
+
+	return images
+}
+
+func isRelatedImageEnv(e corev1.EnvVar) bool {
+	return strings.HasPrefix(e.Name, relatedImageEnvPrefix) && e.Value != ""
+}
+
+// Report is the result of comparing the images declared by
+// ClusterServiceVersions with the images that were discovered.
+type Report struct {
+	// ClusterServiceVersions lists the namespace/name of each compared
+	// ClusterServiceVersion.
+	ClusterServiceVersions []string
+
+	// Undeclared lists images that were observed running, but are not
+	// declared by any ClusterServiceVersion.
+	Undeclared []string
+
+	// Unobserved lists images that are declared by a ClusterServiceVersion,
+	// but were never observed running.
+	Unobserved []string
+}
+
+// Passed reports whether the declared and observed images match.
+func (r Report) Passed() bool {
+	return len(r.Undeclared) == 0 && len(r.Unobserved) == 0
+}
+
+// Compare compares the images declared by csvs with the images observed
+// running in m. Images which were only referenced, rather than observed, are
+// not considered running. Images are compared by their normalized reference.
+func Compare(m discovery.Manifest, csvs []ClusterServiceVersion) Report {
+	report := Report{
+		ClusterServiceVersions: []string{},
+		Undeclared:             []string{},
+		Unobserved:             []string{},
+	}
+
+	declared := map[string]bool{}
+	var declaredImages []string
+	for _, csv := range csvs {
+		report.ClusterServiceVersions = append(report.ClusterServiceVersions, csv.Namespace+"/"+csv.Name)
+		for _, image := range csv.DeclaredImages() {
+			if normalized := imageref.Normalize(image); !declared[normalized] {
+				declared[normalized] = true
+				declaredImages = append(declaredImages, image)
+			}
+		}
+	}
+
+	observed := map[string]bool{}
+	for _, image := range m.DiscoveredImages {
+		if !slices.ContainsFunc(image.Containers, func(c discovery.DiscoveredContainer) bool { return !c.IsReference() }) {
+			continue
+		}
+		normalized := imageref.Normalize(image.Image)
+		observed[normalized] = true
+		if !declared[normalized] && !slices.Contains(report.Undeclared, image.Image) {
+			report.Undeclared = append(report.Undeclared, image.Image)
+		}
+	}
+
+	for _, image := range declaredImages {
+		if !observed[imageref.Normalize(image)] {
+			report.Unobserved = append(report.Unobserved, image)
+		}
+	}
+
+	slices.Sort(report.Undeclared)
+	slices.Sort(report.Unobserved)
+	return report
+}
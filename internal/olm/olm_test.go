@@ -0,0 +1,124 @@
+package olm
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+func newCSV(name, namespace string, labels map[string]any, relatedImages []any, containers []any) *unstructured.Unstructured {
+	metadata := map[string]any{"name": name, "namespace": namespace}
+	if labels != nil {
+		metadata["labels"] = labels
+	}
+
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "operators.coreos.com/v1alpha1",
+		"kind":       "ClusterServiceVersion",
+		"metadata":   metadata,
+		"spec": map[string]any{
+			"relatedImages": relatedImages,
+			"install": map[string]any{
+				"strategy": "deployment",
+				"spec": map[string]any{
+					"deployments": []any{
+						map[string]any{
+							"name": name + "-controller",
+							"spec": map[string]any{
+								"selector": map[string]any{},
+								"template": map[string]any{
+									"spec": map[string]any{"containers": containers},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+}
+
+func TestFindClusterServiceVersions(t *testing.T) {
+	t.Parallel()
+	original := newCSV(
+		"operator.v1", "operators",
+		nil,
+		[]any{map[string]any{"name": "db", "image": "example.com/org/db:1"}},
+		[]any{map[string]any{
+			"name":  "manager",
+			"image": "example.com/org/operator:1",
+			"env": []any{
+				map[string]any{"name": "RELATED_IMAGE_PROXY", "value": "example.com/org/proxy:1"},
+				map[string]any{"name": "LOG_LEVEL", "value": "debug"},
+			},
+		}},
+	)
+	// OLM copies the CSV into each target namespace.
+	copied := newCSV("operator.v1", "workloads", map[string]any{CopiedFromLabel: "operators"}, nil, nil)
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{ClusterServiceVersionGVR: "ClusterServiceVersionList"},
+		original, copied,
+	)
+
+	csvs, err := FindClusterServiceVersions(context.TODO(), client, []string{"workloads", "operators"})
+	if err != nil {
+		t.Fatalf("FindClusterServiceVersions returned an unexpected error: %q", err)
+	}
+
+	if len(csvs) != 1 || csvs[0].Namespace != "operators" {
+		t.Fatalf("FindClusterServiceVersions returned %v; expected only the original CSV", csvs)
+	}
+
+	expected := []string{"example.com/org/db:1", "example.com/org/operator:1", "example.com/org/proxy:1"}
+	if actual := csvs[0].DeclaredImages(); !slices.Equal(actual, expected) {
+		t.Fatalf("DeclaredImages returned %v; expected %v", actual, expected)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+	csv := ClusterServiceVersion{
+		Spec: ClusterServiceVersionSpec{
+			RelatedImages: []RelatedImage{
+				{Name: "operator", Image: "example.com/org/operator:1"},
+				{Name: "db", Image: "example.com/org/db:1"},
+				{Name: "proxy", Image: "docker.io/library/nginx:latest"},
+			},
+		},
+	}
+	csv.Name, csv.Namespace = "operator.v1", "operators"
+
+	running := discovery.DiscoveredContainer{Name: "c", Type: discovery.ContainerTypeStandard}
+	referenced := discovery.DiscoveredContainer{Name: "c", Type: discovery.ContainerTypeStandard, ReferencedBy: "env:RELATED_IMAGE_DB"}
+	m := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{Image: "example.com/org/operator:1", Containers: []discovery.DiscoveredContainer{running}},
+			{Image: "example.com/org/db:1", Containers: []discovery.DiscoveredContainer{referenced}},
+			{Image: "nginx", Containers: []discovery.DiscoveredContainer{running}},
+			{Image: "example.com/org/sidecar:1", Containers: []discovery.DiscoveredContainer{running}},
+		},
+	}
+
+	report := Compare(m, []ClusterServiceVersion{csv})
+	if report.Passed() {
+		t.Fatalf("Compare passed with mismatched images: %+v", report)
+	}
+	if !slices.Equal(report.ClusterServiceVersions, []string{"operators/operator.v1"}) {
+		t.Errorf("Compare reported CSVs %v", report.ClusterServiceVersions)
+	}
+	if expected := []string{"example.com/org/sidecar:1"}; !slices.Equal(report.Undeclared, expected) {
+		t.Errorf("Compare reported undeclared images %v; expected %v", report.Undeclared, expected)
+	}
+	if expected := []string{"example.com/org/db:1"}; !slices.Equal(report.Unobserved, expected) {
+		t.Errorf("Compare reported unobserved images %v; expected %v", report.Unobserved, expected)
+	}
+}
@@ -0,0 +1,220 @@
+package olm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+// invalidNameChars matches the characters which are not allowed in related
+// image names.
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// relatedImagesSnippet is the shape of the relatedImages YAML written by
+// WriteRelatedImages, so that it can be pasted into a CSV's spec.
+type relatedImagesSnippet struct {
+	RelatedImages []RelatedImage `json:"relatedImages"`
+}
+
+// PatchOperation is a single JSON patch (RFC 6902) operation.
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// RelatedImagesFromManifest returns a relatedImages entry for each distinct
+// image in m, by the origin of the image rather than the internal registry or
+// mirror it was pulled from. References are pinned to their digest when one is
+// known, and images which resolve to the same reference are collapsed into one
+// entry. Names are derived from the containers using each image.
+func RelatedImagesFromManifest(m discovery.Manifest) []RelatedImage {
+	var related []RelatedImage
+	seen := map[string]bool{}
+	usedNames := map[string]bool{}
+	for _, image := range m.DiscoveredImages {
+		pinned := PinnedReference(image)
+		if seen[imageref.Normalize(pinned)] {
+			continue
+		}
+		seen[imageref.Normalize(pinned)] = true
+
+		related = append(related, RelatedImage{
+			Name:  uniqueName(relatedImageName(image), image.Origin(), usedNames),
+			Image: pinned,
+		})
+	}
+
+	return related
+}
+
+// PinnedReference returns the origin of image pinned to its digest, if one is
+// known from the reference or from the registry inspection of the origin.
+// Otherwise the origin is returned as it was discovered.
+func PinnedReference(image discovery.DiscoveredImage) string {
+	origin := image.Origin()
+	ref, err := imageref.Parse(origin)
+	if err != nil {
+		return origin
+	}
+
+	digest := ref.Digest
+	if digest == "" && image.Inspection != nil {
+		digest = image.Inspection.Digest
+	}
+	if digest == "" {
+		return origin
+	}
+
+	return ref.Name() + "@" + digest
+}
+
+// relatedImageName derives a name for image from the first container running
+// it, or the environment variable referencing it. The repository name is used
+// if neither is available.
+func relatedImageName(image discovery.DiscoveredImage) string {
+	containers := slices.Clone(image.Containers)
+	// Prefer containers running the image over those referencing it.
+	slices.SortStableFunc(containers, func(a, b discovery.DiscoveredContainer) int {
+		switch {
+		case a.IsReference() == b.IsReference():
+			return 0
+		case a.IsReference():
+			return 1
+		default:
+			return -1
+		}
+	})
+
+	for _, c := range containers {
+		if !c.IsReference() && c.Name != "" {
+			return sanitizeName(c.Name)
+		}
+		if env, found := strings.CutPrefix(c.ReferencedBy, "env:"); found {
+			if name := sanitizeName(strings.TrimPrefix(env, relatedImageEnvPrefix)); name != "" {
+				return name
+			}
+		}
+	}
+
+	return repositoryBaseName(image.Origin())
+}
+
+// uniqueName returns name if it is not yet used. Otherwise the repository
+// name of image, and then a counter, are appended until the name is unique.
+func uniqueName(name, image string, used map[string]bool) string {
+	candidates := []string{name, name + "-" + repositoryBaseName(image)}
+	for _, candidate := range candidates {
+		if !used[candidate] {
+			used[candidate] = true
+			return candidate
+		}
+	}
+
+	for i := 2; ; i++ {
+		candidate := candidates[1] + "-" + strconv.Itoa(i)
+		if !used[candidate] {
+			used[candidate] = true
+			return candidate
+		}
+	}
+}
+
+func repositoryBaseName(image string) string {
+	ref, err := imageref.Parse(image)
+	if err != nil {
+		return "image"
+	}
+
+	return sanitizeName(path.Base(ref.Repository))
+}
+
+func sanitizeName(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+	return strings.Trim(invalidNameChars.ReplaceAllString(name, "-"), "-")
+}
+
+// WriteRelatedImages writes related as a relatedImages YAML snippet, ready to
+// be pasted into the spec of a ClusterServiceVersion.
+func WriteRelatedImages(out io.Writer, related []RelatedImage) error {
+	snippet, err := yaml.Marshal(relatedImagesSnippet{RelatedImages: related})
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(snippet)
+	return err
+}
+
+// ReadClusterServiceVersionFile decodes the YAML or JSON encoded
+// ClusterServiceVersion stored at path.
+func ReadClusterServiceVersionFile(csvPath string) (ClusterServiceVersion, error) {
+	content, err := os.ReadFile(csvPath)
+	if err != nil {
+		return ClusterServiceVersion{}, err
+	}
+
+	csv := ClusterServiceVersion{}
+	if err := yaml.Unmarshal(content, &csv); err != nil {
+		return ClusterServiceVersion{}, fmt.Errorf("unable to decode ClusterServiceVersion %s: %w", csvPath, err)
+	}
+
+	return csv, nil
+}
+
+// RelatedImagesPatch returns the JSON patch operations which add each of
+// related to the relatedImages of csv, skipping images it already declares.
+// Names which are already used by csv are made unique.
+func RelatedImagesPatch(csv ClusterServiceVersion, related []RelatedImage) []PatchOperation {
+	declared := map[string]bool{}
+	usedNames := map[string]bool{}
+	for _, existing := range csv.Spec.RelatedImages {
+		declared[imageref.Normalize(existing.Image)] = true
+		usedNames[existing.Name] = true
+	}
+
+	var missing []RelatedImage
+	for _, r := range related {
+		if declared[imageref.Normalize(r.Image)] {
+			continue
+		}
+		missing = append(missing, RelatedImage{Name: uniqueName(r.Name, r.Image, usedNames), Image: r.Image})
+	}
+
+	if len(missing) == 0 {
+		return []PatchOperation{}
+	}
+
+	if csv.Spec.RelatedImages == nil {
+		return []PatchOperation{{Op: "add", Path: "/spec/relatedImages", Value: missing}}
+	}
+
+	ops := make([]PatchOperation, 0, len(missing))
+	for _, r := range missing {
+		ops = append(ops, PatchOperation{Op: "add", Path: "/spec/relatedImages/-", Value: r})
+	}
+
+	return ops
+}
+
+// WriteRelatedImagesPatch writes ops to out as a JSON patch document.
+func WriteRelatedImagesPatch(out io.Writer, ops []PatchOperation) error {
+	patchJSON, err := json.MarshalIndent(ops, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, string(patchJSON))
+	return err
+}
@@ -0,0 +1,162 @@
+package olm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opdev/discover-workload/discovery"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestRelatedImagesFromManifest(t *testing.T) {
+	t.Parallel()
+	m := discovery.Manifest{
+		DiscoveredImages: []discovery.DiscoveredImage{
+			{
+				Image:      "example.com/org/operator:1@" + testDigest,
+				Containers: []discovery.DiscoveredContainer{{Name: "manager"}},
+			},
+			{
+				// Collapsed with the previous image once pinned to its digest.
+				Image:      "example.com/org/operator@" + testDigest,
+				Containers: []discovery.DiscoveredContainer{{Name: "manager"}},
+			},
+			{
+				Image:      "example.com/org/other-manager:1",
+				Containers: []discovery.DiscoveredContainer{{Name: "manager"}},
+			},
+			{
+				Image: "example.com/org/db:1",
+				Containers: []discovery.DiscoveredContainer{
+					{Name: "manager", ReferencedBy: "env:RELATED_IMAGE_POSTGRES_DB"},
+				},
+			},
+			{
+				Image: "example.com/org/proxy:1",
+			},
+			{
+				// Pinned to the digest found by inspecting its registry.
+				Image:      "example.com/org/webhook:1",
+				Inspection: &discovery.ImageInspection{Digest: testDigest},
+				Containers: []discovery.DiscoveredContainer{{Name: "webhook"}},
+			},
+			{
+				// Listed by the external image an ImageStream imported.
+				Image:       "image-registry.openshift-image-registry.svc:5000/ns/cache:1",
+				SourceImage: "example.com/org/cache:1",
+				Containers:  []discovery.DiscoveredContainer{{Name: "cache"}},
+			},
+			{
+				// Listed by its canonical source rather than the mirror it
+				// was pulled from, pinned to the digest of that source.
+				Image:          "mirror.example.com/org/exporter:1",
+				CanonicalImage: "example.com/org/exporter:1",
+				Inspection:     &discovery.ImageInspection{Digest: testDigest},
+			},
+		},
+	}
+
+	expected := []RelatedImage{
+		{Name: "manager", Image: "example.com/org/operator@" + testDigest},
+		{Name: "manager-other-manager", Image: "example.com/org/other-manager:1"},
+		{Name: "postgres-db", Image: "example.com/org/db:1"},
+		{Name: "proxy", Image: "example.com/org/proxy:1"},
+		{Name: "webhook", Image: "example.com/org/webhook@" + testDigest},
+		{Name: "cache", Image: "example.com/org/cache:1"},
+		{Name: "exporter", Image: "example.com/org/exporter@" + testDigest},
+	}
+
+	actual := RelatedImagesFromManifest(m)
+	if len(actual) != len(expected) {
+		t.Fatalf("RelatedImagesFromManifest returned %v; expected %v", actual, expected)
+	}
+	for idx := range actual {
+		if actual[idx] != expected[idx] {
+			t.Fatalf("RelatedImagesFromManifest returned %v; expected %v", actual, expected)
+		}
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := WriteRelatedImages(buffer, actual[2:3]); err != nil {
+		t.Fatalf("WriteRelatedImages returned an unexpected error: %q", err)
+	}
+	expectedYAML := "relatedImages:\n- image: example.com/org/db:1\n  name: postgres-db\n"
+	if buffer.String() != expectedYAML {
+		t.Fatalf("WriteRelatedImages wrote %q; expected %q", buffer.String(), expectedYAML)
+	}
+}
+
+func TestRelatedImagesPatch(t *testing.T) {
+	t.Parallel()
+	related := []RelatedImage{
+		{Name: "manager", Image: "example.com/org/operator:1"},
+		{Name: "db", Image: "example.com/org/db:1"},
+	}
+
+	testcases := map[string]struct {
+		csv      string
+		expected string
+	}{
+		"without relatedImages": {
+			csv: "apiVersion: operators.coreos.com/v1alpha1\nkind: ClusterServiceVersion\nspec: {}\n",
+			expected: `[
+    {
+        "op": "add",
+        "path": "/spec/relatedImages",
+        "value": [
+            {
+                "name": "manager",
+                "image": "example.com/org/operator:1"
+            },
+            {
+                "name": "db",
+                "image": "example.com/org/db:1"
+            }
+        ]
+    }
+]
+`,
+		},
+		"with relatedImages": {
+			csv: "spec:\n  relatedImages:\n  - name: db\n    image: example.com/org/operator:1\n",
+			expected: `[
+    {
+        "op": "add",
+        "path": "/spec/relatedImages/-",
+        "value": {
+            "name": "db-db",
+            "image": "example.com/org/db:1"
+        }
+    }
+]
+`,
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			csvPath := filepath.Join(t.TempDir(), "operator.clusterserviceversion.yaml")
+			if err := os.WriteFile(csvPath, []byte(tc.csv), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			csv, err := ReadClusterServiceVersionFile(csvPath)
+			if err != nil {
+				t.Fatalf("ReadClusterServiceVersionFile returned an unexpected error: %q", err)
+			}
+
+			buffer := &bytes.Buffer{}
+			if err := WriteRelatedImagesPatch(buffer, RelatedImagesPatch(csv, related)); err != nil {
+				t.Fatalf("WriteRelatedImagesPatch returned an unexpected error: %q", err)
+			}
+
+			if buffer.String() != tc.expected {
+				t.Fatalf("RelatedImagesPatch produced\n%s\nexpected\n%s", buffer.String(), tc.expected)
+			}
+		})
+	}
+}
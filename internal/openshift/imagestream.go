@@ -0,0 +1,247 @@
+// Package openshift reads the OpenShift resources which change where images
+// are pulled from, such as ImageStreams, to relate the images pods reference to
+// the images they originate from.
+package openshift
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+// dockerImageKind is the kind of an ImageStream tag's source when it is
+// imported from a registry.
+const dockerImageKind = "DockerImage"
+
+// InternalRegistryHosts are the hosts pods use to pull images from the
+// OpenShift internal registry.
+var InternalRegistryHosts = []string{
+	"image-registry.openshift-image-registry.svc:5000",
+	"image-registry.openshift-image-registry.svc.cluster.local:5000",
+}
+
+var (
+	// ImageStreamGVR identifies ImageStreams for the dynamic client.
+	ImageStreamGVR = schema.GroupVersionResource{
+		Group:    "image.openshift.io",
+		Version:  "v1",
+		Resource: "imagestreams",
+	}
+
+	// ImageStreamTagGVR identifies ImageStreamTags for the dynamic client.
+	ImageStreamTagGVR = schema.GroupVersionResource{
+		Group:    "image.openshift.io",
+		Version:  "v1",
+		Resource: "imagestreamtags",
+	}
+)
+
+// ImageStream holds the parts of an ImageStream which relate its tags to the
+// images they were imported from.
+type ImageStream struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ImageStreamSpec   `json:"spec,omitempty"`
+	Status ImageStreamStatus `json:"status,omitempty"`
+}
+
+// ImageStreamSpec lists the tags of an ImageStream.
+type ImageStreamSpec struct {
+	Tags []TagReference `json:"tags,omitempty"`
+}
+
+// TagReference is a tag of an ImageStream, and where it is imported from.
+type TagReference struct {
+	Name string           `json:"name"`
+	From *ObjectReference `json:"from,omitempty"`
+}
+
+// ObjectReference is the source of an ImageStream tag, e.g. a DockerImage
+// with the pull spec as its name.
+type ObjectReference struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// ImageStreamStatus records the images each tag of an ImageStream has
+// pointed to.
+type ImageStreamStatus struct {
+	Tags []NamedTagEventList `json:"tags,omitempty"`
+}
+
+// NamedTagEventList is the history of the images a tag has pointed to, most
+// recent first.
+type NamedTagEventList struct {
+	Tag   string     `json:"tag"`
+	Items []TagEvent `json:"items"`
+}
+
+// TagEvent is an image a tag pointed to, by its pull spec and digest.
+type TagEvent struct {
+	DockerImageReference string `json:"dockerImageReference"`
+	Image                string `json:"image"`
+}
+
+// ImageStreamTag holds the parts of an ImageStreamTag which identify its
+// source and current image.
+type ImageStreamTag struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Tag   *TagReference `json:"tag,omitempty"`
+	Image Image         `json:"image"`
+}
+
+// Image is an image known to OpenShift, by its pull spec.
+type Image struct {
+	DockerImageReference string `json:"dockerImageReference,omitempty"`
+}
+
+// IsInternalRegistry reports whether image is pulled from the OpenShift
+// internal registry.
+func IsInternalRegistry(image string) bool {
+	ref, err := imageref.Parse(image)
+	if err != nil {
+		return false
+	}
+
+	return slices.Contains(InternalRegistryHosts, ref.Registry)
+}
+
+// ImageStreamResolver resolves images in the OpenShift internal registry to
+// the ImageStreams they belong to, and the images those were imported from.
+// Each image is only resolved once. It is safe for concurrent use.
+type ImageStreamResolver struct {
+	client dynamic.Interface
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	resolved map[string]resolvedImage
+}
+
+// resolvedImage is the ImageStream and source an image resolved to.
+type resolvedImage struct {
+	stream string
+	source string
+}
+
+// NewImageStreamResolver returns an ImageStreamResolver which retrieves
+// ImageStreams and ImageStreamTags with client.
+func NewImageStreamResolver(client dynamic.Interface, logger *slog.Logger) *ImageStreamResolver {
+	return &ImageStreamResolver{client: client, logger: logger, resolved: map[string]resolvedImage{}}
+}
+
+// Resolve returns the ImageStream tag or image which image refers to, e.g.
+// "ns/name:tag" or "ns/name@sha256:...", and the external image it was
+// imported from. Both are empty if image is not in the internal registry, and
+// the source is empty if the image was pushed to the internal registry.
+func (r *ImageStreamResolver) Resolve(ctx context.Context, image string) (stream, source string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if resolved, found := r.resolved[image]; found {
+		return resolved.stream, resolved.source
+	}
+
+	stream, source = r.resolve(ctx, image)
+	r.resolved[image] = resolvedImage{stream: stream, source: source}
+
+	return stream, source
+}
+
+func (r *ImageStreamResolver) resolve(ctx context.Context, image string) (stream, source string) {
+	ref, err := imageref.Parse(image)
+	if err != nil || !slices.Contains(InternalRegistryHosts, ref.Registry) {
+		return "", ""
+	}
+
+	namespace, name, found := strings.Cut(ref.Repository, "/")
+	if !found || strings.Contains(name, "/") {
+		return "", ""
+	}
+
+	if ref.Digest != "" {
+		stream = ref.Repository + "@" + ref.Digest
+		is := ImageStream{}
+		if err := r.get(ctx, ImageStreamGVR, namespace, name, &is); err != nil {
+			r.logger.Debug("unable to look up ImageStream", "namespace", namespace, "name", name, "errMsg", err)
+			return stream, ""
+		}
+
+		return stream, SourceOfDigest(is, ref.Digest)
+	}
+
+	tag := ref.Tag
+	if tag == "" {
+		tag = imageref.DefaultTag
+	}
+	stream = ref.Repository + ":" + tag
+	ist := ImageStreamTag{}
+	if err := r.get(ctx, ImageStreamTagGVR, namespace, name+":"+tag, &ist); err != nil {
+		r.logger.Debug("unable to look up ImageStreamTag", "namespace", namespace, "name", name+":"+tag, "errMsg", err)
+		return stream, ""
+	}
+
+	return stream, SourceOfTag(ist)
+}
+
+// get retrieves the named object of gvr into obj.
+func (r *ImageStreamResolver) get(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string, obj any) error {
+	u, err := r.client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), obj)
+}
+
+// SourceOfDigest returns the external image which the image with digest in
+// is was imported from, or an empty string if it was not imported.
+func SourceOfDigest(is ImageStream, digest string) string {
+	for _, tag := range is.Status.Tags {
+		for _, item := range tag.Items {
+			if item.Image != digest {
+				continue
+			}
+			if item.DockerImageReference != "" && !IsInternalRegistry(item.DockerImageReference) {
+				return item.DockerImageReference
+			}
+
+			// With the Local reference policy, the tag history points to
+			// the internal registry, so the repository is taken from the
+			// tag's source instead.
+			for _, spec := range is.Spec.Tags {
+				if spec.Name == tag.Tag && spec.From != nil && spec.From.Kind == dockerImageKind {
+					if from, err := imageref.Parse(spec.From.Name); err == nil {
+						return imageref.Reference{Registry: from.Registry, Repository: from.Repository, Digest: digest}.String()
+					}
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// SourceOfTag returns the external image which ist was imported from, pinned
+// to its digest when possible, or an empty string if it was not imported.
+func SourceOfTag(ist ImageStreamTag) string {
+	if ref := ist.Image.DockerImageReference; ref != "" && !IsInternalRegistry(ref) {
+		return ref
+	}
+	if ist.Tag != nil && ist.Tag.From != nil && ist.Tag.From.Kind == dockerImageKind {
+		return ist.Tag.From.Name
+	}
+
+	return ""
+}
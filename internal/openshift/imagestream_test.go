@@ -0,0 +1,100 @@
+package openshift
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const (
+	importedDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	localDigest    = "sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+	pushedDigest   = "sha256:00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	internal       = "image-registry.openshift-image-registry.svc:5000"
+)
+
+func TestImageStreamResolver(t *testing.T) {
+	t.Parallel()
+	is := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "image.openshift.io/v1",
+		"kind":       "ImageStream",
+		"metadata":   map[string]any{"name": "app", "namespace": "ns"},
+		"spec": map[string]any{
+			"tags": []any{
+				map[string]any{"name": "1.0", "from": map[string]any{"kind": "DockerImage", "name": "quay.io/org/app:1.0"}},
+				map[string]any{"name": "local", "from": map[string]any{"kind": "DockerImage", "name": "quay.io/org/app:2.0"}},
+			},
+		},
+		"status": map[string]any{
+			"tags": []any{
+				map[string]any{"tag": "1.0", "items": []any{
+					map[string]any{"dockerImageReference": "quay.io/org/app@" + importedDigest, "image": importedDigest},
+				}},
+				map[string]any{"tag": "local", "items": []any{
+					map[string]any{"dockerImageReference": internal + "/ns/app@" + localDigest, "image": localDigest},
+				}},
+				map[string]any{"tag": "pushed", "items": []any{
+					map[string]any{"dockerImageReference": internal + "/ns/app@" + pushedDigest, "image": pushedDigest},
+				}},
+			},
+		},
+	}}
+	ist := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "image.openshift.io/v1",
+		"kind":       "ImageStreamTag",
+		"metadata":   map[string]any{"name": "app:1.0", "namespace": "ns"},
+		"tag":        map[string]any{"name": "1.0", "from": map[string]any{"kind": "DockerImage", "name": "quay.io/org/app:1.0"}},
+		"image":      map[string]any{"dockerImageReference": "quay.io/org/app@" + importedDigest},
+	}}
+
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), is, ist)
+	resolver := NewImageStreamResolver(client, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	testcases := map[string]struct {
+		image          string
+		expectedStream string
+		expectedSource string
+	}{
+		"imported tag": {
+			image:          internal + "/ns/app:1.0",
+			expectedStream: "ns/app:1.0",
+			expectedSource: "quay.io/org/app@" + importedDigest,
+		},
+		"imported digest": {
+			image:          internal + "/ns/app@" + importedDigest,
+			expectedStream: "ns/app@" + importedDigest,
+			expectedSource: "quay.io/org/app@" + importedDigest,
+		},
+		"digest with the Local reference policy": {
+			image:          "image-registry.openshift-image-registry.svc.cluster.local:5000/ns/app@" + localDigest,
+			expectedStream: "ns/app@" + localDigest,
+			expectedSource: "quay.io/org/app@" + localDigest,
+		},
+		"pushed digest": {
+			image:          internal + "/ns/app@" + pushedDigest,
+			expectedStream: "ns/app@" + pushedDigest,
+		},
+		"missing tag": {
+			image:          internal + "/ns/app:2.0",
+			expectedStream: "ns/app:2.0",
+		},
+		"external image": {
+			image: "quay.io/org/app:1.0",
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			stream, source := resolver.Resolve(context.TODO(), tc.image)
+			if stream != tc.expectedStream || source != tc.expectedSource {
+				t.Fatalf("Resolve returned (%q, %q); expected (%q, %q)", stream, source, tc.expectedStream, tc.expectedSource)
+			}
+		})
+	}
+}
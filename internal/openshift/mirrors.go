@@ -0,0 +1,327 @@
+package openshift
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+const (
+	// ImageDigestMirrorSetKind redirects pulls by digest to mirrors.
+	ImageDigestMirrorSetKind = "ImageDigestMirrorSet"
+
+	// ImageTagMirrorSetKind redirects pulls by tag to mirrors.
+	ImageTagMirrorSetKind = "ImageTagMirrorSet"
+
+	// ImageContentSourcePolicyKind is the legacy form of an
+	// ImageDigestMirrorSet.
+	ImageContentSourcePolicyKind = "ImageContentSourcePolicy"
+)
+
+// mirrorSetGVRs identify the kinds of mirror sets for the dynamic client.
+var mirrorSetGVRs = map[string]schema.GroupVersionResource{
+	ImageDigestMirrorSetKind:     {Group: "config.openshift.io", Version: "v1", Resource: "imagedigestmirrorsets"},
+	ImageTagMirrorSetKind:        {Group: "config.openshift.io", Version: "v1", Resource: "imagetagmirrorsets"},
+	ImageContentSourcePolicyKind: {Group: "operator.openshift.io", Version: "v1alpha1", Resource: "imagecontentsourcepolicies"},
+}
+
+// manifestExtensions are the extensions of the files read from directories.
+var manifestExtensions = []string{".yaml", ".yml", ".json"}
+
+// MirrorRule redirects pulls of the images in Source to Mirrors.
+type MirrorRule struct {
+	// Source is a registry or repository, e.g. "registry.redhat.io/ubi9",
+	// which applies to every repository below it. A registry may start with
+	// a "*." wildcard to match its subdomains.
+	Source string
+
+	// Mirrors are the registries or repositories which Source is mirrored
+	// to, in order of preference.
+	Mirrors []string
+
+	// Tags reports whether the rule applies to pulls by tag, as set by an
+	// ImageTagMirrorSet, rather than to pulls by digest.
+	Tags bool
+}
+
+// MirrorRules are the mirror rules configured in a cluster.
+type MirrorRules []MirrorRule
+
+// imageMirrors is an entry of a mirror set.
+type imageMirrors struct {
+	Source  string   `json:"source"`
+	Mirrors []string `json:"mirrors,omitempty"`
+}
+
+// mirrorSet holds the parts of an ImageDigestMirrorSet, ImageTagMirrorSet or
+// ImageContentSourcePolicy which configure mirrors.
+type mirrorSet struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Spec struct {
+		ImageDigestMirrors      []imageMirrors `json:"imageDigestMirrors,omitempty"`
+		ImageTagMirrors         []imageMirrors `json:"imageTagMirrors,omitempty"`
+		RepositoryDigestMirrors []imageMirrors `json:"repositoryDigestMirrors,omitempty"`
+	} `json:"spec"`
+}
+
+// rules returns the mirror rules of s.
+func (s mirrorSet) rules() MirrorRules {
+	var rules MirrorRules
+	for _, entry := range slices.Concat(s.Spec.ImageDigestMirrors, s.Spec.RepositoryDigestMirrors) {
+		rules = append(rules, MirrorRule{Source: entry.Source, Mirrors: entry.Mirrors})
+	}
+	for _, entry := range s.Spec.ImageTagMirrors {
+		rules = append(rules, MirrorRule{Source: entry.Source, Mirrors: entry.Mirrors, Tags: true})
+	}
+
+	return rules
+}
+
+// FindMirrorRules returns the rules of the ImageDigestMirrorSets,
+// ImageTagMirrorSets and ImageContentSourcePolicies in the cluster. Kinds the
+// cluster does not serve are skipped.
+func FindMirrorRules(ctx context.Context, client dynamic.Interface, logger *slog.Logger) (MirrorRules, error) {
+	var rules MirrorRules
+	for _, kind := range []string{ImageDigestMirrorSetKind, ImageTagMirrorSetKind, ImageContentSourcePolicyKind} {
+		list, err := client.Resource(mirrorSetGVRs[kind]).List(ctx, metav1.ListOptions{})
+		if apierrors.IsNotFound(err) {
+			logger.Debug("the cluster does not serve this kind of mirror set", "kind", kind)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to list %ss: %w", kind, err)
+		}
+
+		for _, obj := range list.Items {
+			raw, err := obj.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			found, err := decodeMirrorSet(raw, kind)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode %s %s: %w", kind, obj.GetName(), err)
+			}
+			rules = append(rules, found...)
+		}
+	}
+
+	return rules, nil
+}
+
+// ReadMirrorRules reads the mirror sets in each of paths. A path may be a file
+// or a directory whose YAML and JSON files are read recursively. Objects of
+// any other kind are ignored.
+func ReadMirrorRules(paths []string) (MirrorRules, error) {
+	var rules MirrorRules
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// Files provided explicitly are always read, but directories are
+			// filtered by extension.
+			if d.IsDir() || (p != path && !slices.Contains(manifestExtensions, strings.ToLower(filepath.Ext(p)))) {
+				return nil
+			}
+
+			found, err := readMirrorRulesFromFile(p)
+			if err != nil {
+				return err
+			}
+			rules = append(rules, found...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return rules, nil
+}
+
+func readMirrorRulesFromFile(path string) (MirrorRules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules, err := DecodeMirrorRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read mirror sets from %s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+// DecodeMirrorRules decodes a stream of YAML documents or JSON objects into the
+// rules of the mirror sets among them. Lists are expanded.
+func DecodeMirrorRules(r io.Reader) (MirrorRules, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	var rules MirrorRules
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return rules, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		found, err := decodeMirrorSet(raw, "")
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, found...)
+	}
+}
+
+// decodeMirrorSet decodes the rules of a single mirror set, or of a list of
+// them. Items without a kind are decoded as itemKind.
+func decodeMirrorSet(raw json.RawMessage, itemKind string) (MirrorRules, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	set := mirrorSet{}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+
+	kind := cmp.Or(set.Kind, itemKind)
+	switch {
+	case kind == "List" || strings.HasSuffix(kind, "List"):
+		list := struct {
+			Items []json.RawMessage `json:"items"`
+		}{}
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, err
+		}
+
+		var rules MirrorRules
+		for _, item := range list.Items {
+			found, err := decodeMirrorSet(item, strings.TrimSuffix(kind, "List"))
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, found...)
+		}
+		return rules, nil
+	case mirrorSetGVRs[kind] != schema.GroupVersionResource{}:
+		return set.rules(), nil
+	default:
+		return nil, nil
+	}
+}
+
+// Resolve returns the canonical source of image and the locations it is
+// mirrored to, according to rules. image may either name the source, or one of
+// its mirrors. The canonical source is empty if no rule applies to image.
+func (rules MirrorRules) Resolve(image string) (canonical string, mirrors []string) {
+	ref, err := imageref.Parse(image)
+	if err != nil {
+		return "", nil
+	}
+	// Pulls by digest are redirected by digest mirror sets, and pulls by
+	// tag by tag mirror sets.
+	applicable := slices.DeleteFunc(slices.Clone(rules), func(rule MirrorRule) bool {
+		return rule.Tags != (ref.Digest == "")
+	})
+
+	name := ref.Name()
+	for _, rule := range applicable {
+		for _, mirror := range rule.Mirrors {
+			if rest, found := matchScope(mirror, name); found && !strings.HasPrefix(rule.Source, "*.") {
+				return resolveSource(applicable, rule.Source+rest, ref)
+			}
+		}
+	}
+
+	return resolveSource(applicable, name, ref)
+}
+
+// resolveSource returns the reference of ref in the repository name, and its
+// locations in the mirrors of the most specific of applicable whose source
+// matches name.
+func resolveSource(applicable MirrorRules, name string, ref imageref.Reference) (string, []string) {
+	var matched []MirrorRule
+	best := -1
+	for _, rule := range applicable {
+		if _, found := matchScope(rule.Source, name); !found {
+			continue
+		}
+		switch specificity := len(strings.TrimPrefix(rule.Source, "*.")); {
+		case specificity > best:
+			best = specificity
+			matched = []MirrorRule{rule}
+		case specificity == best:
+			matched = append(matched, rule)
+		}
+	}
+	if len(matched) == 0 {
+		return "", nil
+	}
+
+	var mirrors []string
+	for _, rule := range matched {
+		rest, _ := matchScope(rule.Source, name)
+		for _, mirror := range rule.Mirrors {
+			location := withName(ref, mirror+rest)
+			if !slices.Contains(mirrors, location) {
+				mirrors = append(mirrors, location)
+			}
+		}
+	}
+
+	return withName(ref, name), mirrors
+}
+
+// matchScope reports whether name, a fully qualified repository, is scope or is
+// below it, and returns the rest of name after scope. For a "*." wildcard
+// scope, the rest is the repository after the registry host.
+func matchScope(scope, name string) (string, bool) {
+	if domain, found := strings.CutPrefix(scope, "*."); found {
+		host, repository, _ := strings.Cut(name, "/")
+		if strings.HasSuffix(host, "."+domain) {
+			return "/" + repository, true
+		}
+		return "", false
+	}
+
+	if name == scope {
+		return "", true
+	}
+	if rest, found := strings.CutPrefix(name, scope+"/"); found {
+		return "/" + rest, true
+	}
+
+	return "", false
+}
+
+// withName returns ref with its repository replaced by name, a fully
+// qualified repository.
+func withName(ref imageref.Reference, name string) string {
+	ref.Registry, ref.Repository, _ = strings.Cut(name, "/")
+	return ref.String()
+}
@@ -0,0 +1,176 @@
+package openshift
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const mirrorSets = `apiVersion: config.openshift.io/v1
+kind: ImageDigestMirrorSet
+metadata:
+  name: product
+spec:
+  imageDigestMirrors:
+  - source: registry.redhat.io/ubi9
+    mirrors:
+    - mirror.example.com/ubi9
+    - backup.example.com/rh/ubi9
+  - source: quay.io/my-org
+    mirrors:
+    - mirror.example.com/my-org
+---
+apiVersion: config.openshift.io/v1
+kind: ImageTagMirrorSet
+metadata:
+  name: tags
+spec:
+  imageTagMirrors:
+  - source: quay.io/my-org/operator
+    mirrors:
+    - tags.example.com/operator
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: operator.openshift.io/v1alpha1
+  kind: ImageContentSourcePolicy
+  metadata:
+    name: legacy
+  spec:
+    repositoryDigestMirrors:
+    - source: registry.redhat.io/ubi9
+      mirrors:
+      - legacy.example.com/ubi9
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`
+
+func TestMirrorRulesResolve(t *testing.T) {
+	t.Parallel()
+	rulesPath := filepath.Join(t.TempDir(), "mirrors.yaml")
+	if err := os.WriteFile(rulesPath, []byte(mirrorSets), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := ReadMirrorRules([]string{rulesPath})
+	if err != nil {
+		t.Fatalf("ReadMirrorRules returned an unexpected error: %q", err)
+	}
+	if len(rules) != 4 {
+		t.Fatalf("ReadMirrorRules returned %v; expected 4 rules", rules)
+	}
+
+	digest := "@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	testcases := map[string]struct {
+		image             string
+		expectedCanonical string
+		expectedMirrors   []string
+	}{
+		"source by digest": {
+			image:             "registry.redhat.io/ubi9/ubi-minimal" + digest,
+			expectedCanonical: "registry.redhat.io/ubi9/ubi-minimal" + digest,
+			expectedMirrors: []string{
+				"mirror.example.com/ubi9/ubi-minimal" + digest,
+				"backup.example.com/rh/ubi9/ubi-minimal" + digest,
+				"legacy.example.com/ubi9/ubi-minimal" + digest,
+			},
+		},
+		"mirror by digest": {
+			image:             "backup.example.com/rh/ubi9/ubi" + digest,
+			expectedCanonical: "registry.redhat.io/ubi9/ubi" + digest,
+			expectedMirrors: []string{
+				"mirror.example.com/ubi9/ubi" + digest,
+				"backup.example.com/rh/ubi9/ubi" + digest,
+				"legacy.example.com/ubi9/ubi" + digest,
+			},
+		},
+		"source by tag": {
+			image:             "quay.io/my-org/operator:1.0",
+			expectedCanonical: "quay.io/my-org/operator:1.0",
+			expectedMirrors:   []string{"tags.example.com/operator:1.0"},
+		},
+		"digest mirror sets do not apply to tags": {
+			image: "quay.io/my-org/operand:1.0",
+		},
+		"unrelated repository": {
+			image: "registry.redhat.io/ubi8/ubi" + digest,
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			canonical, mirrors := rules.Resolve(tc.image)
+			if canonical != tc.expectedCanonical || !slices.Equal(mirrors, tc.expectedMirrors) {
+				t.Fatalf("Resolve returned (%q, %v); expected (%q, %v)", canonical, mirrors, tc.expectedCanonical, tc.expectedMirrors)
+			}
+		})
+	}
+}
+
+func TestMirrorRulesWildcardSource(t *testing.T) {
+	t.Parallel()
+	rules := MirrorRules{{Source: "*.redhat.io", Mirrors: []string{"mirror.example.com"}}}
+	digest := "@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	canonical, mirrors := rules.Resolve("registry.redhat.io/ubi9/ubi" + digest)
+	if canonical != "registry.redhat.io/ubi9/ubi"+digest || !slices.Equal(mirrors, []string{"mirror.example.com/ubi9/ubi" + digest}) {
+		t.Fatalf("Resolve returned (%q, %v)", canonical, mirrors)
+	}
+
+	// The source of an image on the mirror of a wildcard cannot be known.
+	if canonical, _ := rules.Resolve("mirror.example.com/ubi9/ubi" + digest); canonical != "" {
+		t.Fatalf("Resolve returned %q for a mirror of a wildcard source", canonical)
+	}
+}
+
+func TestFindMirrorRules(t *testing.T) {
+	t.Parallel()
+	idms := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "config.openshift.io/v1",
+		"kind":       ImageDigestMirrorSetKind,
+		"metadata":   map[string]any{"name": "product"},
+		"spec": map[string]any{
+			"imageDigestMirrors": []any{
+				map[string]any{"source": "quay.io/my-org", "mirrors": []any{"mirror.example.com/my-org"}},
+			},
+		},
+	}}
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			mirrorSetGVRs[ImageDigestMirrorSetKind]:     "ImageDigestMirrorSetList",
+			mirrorSetGVRs[ImageTagMirrorSetKind]:        "ImageTagMirrorSetList",
+			mirrorSetGVRs[ImageContentSourcePolicyKind]: "ImageContentSourcePolicyList",
+		},
+		idms,
+	)
+	// ImageContentSourcePolicies are not served, as on recent clusters.
+	client.PrependReactor("list", "imagecontentsourcepolicies", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewNotFound(mirrorSetGVRs[ImageContentSourcePolicyKind].GroupResource(), "")
+	})
+
+	rules, err := FindMirrorRules(context.TODO(), client, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("FindMirrorRules returned an unexpected error: %q", err)
+	}
+	if len(rules) != 1 || rules[0].Source != "quay.io/my-org" || !slices.Equal(rules[0].Mirrors, []string{"mirror.example.com/my-org"}) || rules[0].Tags {
+		t.Fatalf("FindMirrorRules returned %v", rules)
+	}
+}
@@ -0,0 +1,209 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+// Credential authenticates with a registry.
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Keychain holds the credentials for registries, keyed by registry host or
+// by repository, e.g. "quay.io" or "quay.io/my-org".
+type Keychain map[string]Credential
+
+// dockerConfigEntry is a single entry of a docker config file.
+type dockerConfigEntry struct {
+	Auth     string `json:"auth,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// dockerConfig is the format of docker and podman auth files, and of
+// kubernetes.io/dockerconfigjson secrets.
+type dockerConfig struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+// Lookup returns the credential for the repository of ref. Credentials for
+// the repository, or for one of its parents, are preferred over those for the
+// whole registry.
+func (k Keychain) Lookup(ref imageref.Reference) (Credential, bool) {
+	for key := ref.Name(); key != "." && key != "/"; key = path.Dir(key) {
+		if cred, found := k[key]; found {
+			return cred, true
+		}
+	}
+
+	return Credential{}, false
+}
+
+// Merge adds the credentials of other which k does not already hold.
+func (k Keychain) Merge(other Keychain) {
+	for key, cred := range other {
+		if _, found := k[key]; !found {
+			k[key] = cred
+		}
+	}
+}
+
+// ParseDockerConfig reads the credentials in a docker config file, in either
+// the current format, with an "auths" key, or the legacy .dockercfg format, in
+// which every key is a registry. Other keys, such as the credsStore and
+// credHelpers of a docker config file, are ignored, as credential helpers are
+// not supported.
+func ParseDockerConfig(content []byte) (Keychain, error) {
+	config := dockerConfig{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, err
+	}
+	if config.Auths == nil {
+		legacy := map[string]dockerConfigEntry{}
+		if err := json.Unmarshal(content, &legacy); err == nil {
+			config.Auths = legacy
+		}
+	}
+
+	keychain := Keychain{}
+	for server, entry := range config.Auths {
+		cred := Credential{Username: entry.Username, Password: entry.Password}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode the credential for %s: %w", server, err)
+			}
+			username, password, found := strings.Cut(string(decoded), ":")
+			if !found {
+				return nil, fmt.Errorf("the credential for %s is malformed", server)
+			}
+			cred = Credential{Username: username, Password: password}
+		}
+
+		keychain[normalizeServer(server)] = cred
+	}
+
+	return keychain, nil
+}
+
+// normalizeServer turns a docker config server key, which may be a URL such as
+// https://index.docker.io/v1/, into a registry host or repository.
+func normalizeServer(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	server = strings.TrimSuffix(server, "/")
+	if host, rest, found := strings.Cut(server, "/"); found && (rest == "v1" || rest == "v2") {
+		server = host
+	}
+
+	if server == "index.docker.io" || server == "registry-1.docker.io" {
+		return imageref.DefaultRegistry
+	}
+
+	return server
+}
+
+// ReadAuthFile reads the credentials in the docker or podman auth file at
+// authPath, e.g. ~/.docker/config.json.
+func ReadAuthFile(authPath string) (Keychain, error) {
+	content, err := os.ReadFile(authPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keychain, err := ParseDockerConfig(content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode auth file %s: %w", authPath, err)
+	}
+
+	return keychain, nil
+}
+
+// KeychainFromSecrets reads the credentials in the image pull secrets of
+// namespaces: those referenced by the pods in each namespace, and by its
+// service accounts, which pass theirs on to the pods using them. Only the
+// referenced secrets are read, so no other credentials are, and listing
+// secrets is not required.
+func KeychainFromSecrets(ctx context.Context, client kubernetes.Interface, namespaces []string) (Keychain, error) {
+	keychain := Keychain{}
+	for _, ns := range namespaces {
+		names, err := pullSecretNames(ctx, client, ns)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			secret, err := client.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				// Pods may reference pull secrets which do not exist.
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("unable to get pull secret %s/%s: %w", ns, name, err)
+			}
+
+			var content []byte
+			switch secret.Type {
+			case corev1.SecretTypeDockerConfigJson:
+				content = secret.Data[corev1.DockerConfigJsonKey]
+			case corev1.SecretTypeDockercfg:
+				content = secret.Data[corev1.DockerConfigKey]
+			default:
+				continue
+			}
+
+			found, err := ParseDockerConfig(content)
+			if err != nil {
+				return nil, fmt.Errorf("unable to decode pull secret %s/%s: %w", ns, secret.Name, err)
+			}
+			keychain.Merge(found)
+		}
+	}
+
+	return keychain, nil
+}
+
+// pullSecretNames returns the names of the image pull secrets referenced by
+// the pods and service accounts in namespace.
+func pullSecretNames(ctx context.Context, client kubernetes.Interface, namespace string) ([]string, error) {
+	var names []string
+	add := func(refs []corev1.LocalObjectReference) {
+		for _, ref := range refs {
+			if ref.Name != "" && !slices.Contains(names, ref.Name) {
+				names = append(names, ref.Name)
+			}
+		}
+	}
+
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list pods in namespace %s: %w", namespace, err)
+	}
+	for _, p := range pods.Items {
+		add(p.Spec.ImagePullSecrets)
+	}
+
+	serviceAccounts, err := client.CoreV1().ServiceAccounts(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list service accounts in namespace %s: %w", namespace, err)
+	}
+	for _, sa := range serviceAccounts.Items {
+		add(sa.ImagePullSecrets)
+	}
+
+	return names, nil
+}
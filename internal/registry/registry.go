@@ -0,0 +1,414 @@
+// Package registry inspects discovered images in their registries, using the
+// OCI Distribution API, to resolve their digests, platforms and labels.
+package registry
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+const (
+	// Media types of the image manifests and indexes which are accepted.
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// dockerHubHost serves the registry API for docker.io.
+	dockerHubHost = "registry-1.docker.io"
+
+	// maxManifestSize bounds the size of the manifests and configs read.
+	maxManifestSize = 4 << 20
+)
+
+// ErrUnauthorized is returned when the registry rejects the request, or
+// requires credentials which are not available.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// CertificationLabels are the config labels recorded for each image, which
+// certification checks.
+var CertificationLabels = []string{"name", "vendor", "version", "release", "summary"}
+
+var (
+	manifestMediaTypes = []string{MediaTypeOCIIndex, MediaTypeDockerManifestList, MediaTypeOCIManifest, MediaTypeDockerManifest}
+	challengeParam     = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// descriptor references content in a registry.
+type descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+	Platform  *platform `json:"platform,omitempty"`
+}
+
+type platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+func (p platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+
+	return s
+}
+
+// manifest holds the fields of image manifests and indexes which are used.
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Manifests []descriptor `json:"manifests"`
+	Config    descriptor   `json:"config"`
+}
+
+// imageConfig holds the fields of an image config which are used.
+type imageConfig struct {
+	platform
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+// Client inspects images using the OCI Distribution API. It is safe for
+// concurrent use.
+type Client struct {
+	httpClient *http.Client
+	keychain   Keychain
+	// insecure lists the registries which are reached over plain HTTP.
+	insecure []string
+
+	mu sync.Mutex
+	// authorizations caches the Authorization header for each repository.
+	authorizations map[string]string
+}
+
+// NewClient returns a Client which sends requests with httpClient, and
+// authenticates with the credentials in keychain. The registries in insecure,
+// e.g. localhost:5000, are reached over plain HTTP rather than HTTPS.
+func NewClient(httpClient *http.Client, keychain Keychain, insecure []string) *Client {
+	if keychain == nil {
+		keychain = Keychain{}
+	}
+
+	return &Client{
+		httpClient:     httpClient,
+		keychain:       keychain,
+		insecure:       insecure,
+		authorizations: map[string]string{},
+	}
+}
+
+// Inspect resolves image in its registry. For multi-arch images, the labels
+// are read from the linux/amd64 image, or the first image of the index.
+func (c *Client) Inspect(ctx context.Context, image string) (*discovery.ImageInspection, error) {
+	ref, err := imageref.Parse(image)
+	if err != nil {
+		return nil, err
+	}
+
+	reference := cmp.Or(ref.Digest, ref.Tag, imageref.DefaultTag)
+	content, mediaType, digest, err := c.getManifest(ctx, ref, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	inspection := &discovery.ImageInspection{Digest: digest, MediaType: mediaType}
+	m := manifest{}
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, fmt.Errorf("unable to decode the manifest of %s: %w", image, err)
+	}
+
+	if mediaType == MediaTypeOCIIndex || mediaType == MediaTypeDockerManifestList {
+		inspection.MultiArch = true
+		var chosen *descriptor
+		for i, d := range m.Manifests {
+			// Attestations are listed with an unknown platform.
+			if d.Platform == nil || d.Platform.OS == "unknown" {
+				continue
+			}
+			inspection.Platforms = append(inspection.Platforms, d.Platform.String())
+			if chosen == nil || (d.Platform.OS == "linux" && d.Platform.Architecture == "amd64" && chosen.Platform.Architecture != "amd64") {
+				chosen = &m.Manifests[i]
+			}
+		}
+		if chosen == nil {
+			return inspection, nil
+		}
+
+		content, _, _, err = c.getManifest(ctx, ref, chosen.Digest)
+		if err != nil {
+			return nil, err
+		}
+		m = manifest{}
+		if err := json.Unmarshal(content, &m); err != nil {
+			return nil, fmt.Errorf("unable to decode the manifest of %s: %w", image, err)
+		}
+	}
+
+	if m.Config.Digest == "" {
+		return inspection, nil
+	}
+
+	config, err := c.getConfig(ctx, ref, m.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if !inspection.MultiArch && config.OS != "" {
+		inspection.Platforms = []string{config.platform.String()}
+	}
+	for _, label := range CertificationLabels {
+		if value, found := config.Config.Labels[label]; found {
+			if inspection.Labels == nil {
+				inspection.Labels = map[string]string{}
+			}
+			inspection.Labels[label] = value
+		}
+	}
+
+	return inspection, nil
+}
+
+// Enrich returns a copy of m in which each image records the inspection of its
+// origin. Images which cannot be inspected record the error instead.
+func (c *Client) Enrich(ctx context.Context, m discovery.Manifest, logger *slog.Logger) discovery.Manifest {
+	enriched := discovery.Manifest{
+		DiscoveredImages: make([]discovery.DiscoveredImage, 0, len(m.DiscoveredImages)),
+	}
+	inspected := map[string]*discovery.ImageInspection{}
+	for _, image := range m.DiscoveredImages {
+		// Images in a cluster's internal registry are inspected where they
+		// were imported from.
+		origin := image.Origin()
+		inspection, found := inspected[origin]
+		if !found {
+			logger.Debug("inspecting image", "image", origin)
+			var err error
+			inspection, err = c.Inspect(ctx, origin)
+			if err != nil {
+				logger.Warn("unable to inspect image", "image", origin, "errMsg", err)
+				inspection = &discovery.ImageInspection{Error: err.Error()}
+			}
+			inspected[origin] = inspection
+		}
+
+		image.Inspection = inspection
+		enriched.DiscoveredImages = append(enriched.DiscoveredImages, image)
+	}
+
+	return enriched
+}
+
+// getManifest returns the manifest or index reference resolves to in the
+// repository of ref, with its media type and digest.
+func (c *Client) getManifest(ctx context.Context, ref imageref.Reference, reference string) ([]byte, string, string, error) {
+	resp, err := c.get(ctx, ref, "manifests/"+reference, manifestMediaTypes)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	if mediaType == "" || !slices.Contains(manifestMediaTypes, mediaType) {
+		m := manifest{}
+		if err := json.Unmarshal(content, &m); err == nil && m.MediaType != "" {
+			mediaType = m.MediaType
+		}
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		sum := sha256.Sum256(content)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	return content, mediaType, digest, nil
+}
+
+func (c *Client) getConfig(ctx context.Context, ref imageref.Reference, digest string) (imageConfig, error) {
+	resp, err := c.get(ctx, ref, "blobs/"+digest, nil)
+	if err != nil {
+		return imageConfig{}, err
+	}
+	defer resp.Body.Close()
+
+	config := imageConfig{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&config); err != nil {
+		return imageConfig{}, fmt.Errorf("unable to decode the config of %s: %w", ref.Name(), err)
+	}
+
+	return config, nil
+}
+
+// get requests path below the repository of ref, authenticating when the
+// registry challenges the request. The caller must close the response body.
+func (c *Client) get(ctx context.Context, ref imageref.Reference, path string, accept []string) (*http.Response, error) {
+	scheme := "https"
+	if slices.Contains(c.insecure, ref.Registry) {
+		scheme = "http"
+	}
+	endpoint := fmt.Sprintf("%s://%s/v2/%s/%s", scheme, registryHost(ref.Registry), ref.Repository, path)
+	repository := ref.Name()
+
+	c.mu.Lock()
+	authorization := c.authorizations[repository]
+	c.mu.Unlock()
+
+	resp, err := c.do(ctx, endpoint, accept, authorization)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		authorization, err = c.authorize(ctx, ref, challenge)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.authorizations[repository] = authorization
+		c.mu.Unlock()
+
+		resp, err = c.do(ctx, endpoint, accept, authorization)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return nil, fmt.Errorf("%w: %s returned %s", ErrUnauthorized, endpoint, resp.Status)
+		}
+		return nil, fmt.Errorf("%s returned %s", endpoint, resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (c *Client) do(ctx context.Context, endpoint string, accept []string, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// authorize answers the WWW-Authenticate challenge of a registry, and returns
+// the Authorization header to send with the following requests.
+func (c *Client) authorize(ctx context.Context, ref imageref.Reference, challenge string) (string, error) {
+	scheme, paramString, _ := strings.Cut(challenge, " ")
+	params := map[string]string{}
+	for _, match := range challengeParam.FindAllStringSubmatch(paramString, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+
+	cred, hasCred := c.keychain.Lookup(ref)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !hasCred {
+			return "", fmt.Errorf("%w: no credentials for %s", ErrUnauthorized, ref.Name())
+		}
+		return "Basic " + basicAuth(cred), nil
+	case "bearer":
+		token, err := c.fetchToken(ctx, ref, params, cred, hasCred)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	default:
+		return "", fmt.Errorf("%w: unsupported challenge %q from %s", ErrUnauthorized, challenge, ref.Registry)
+	}
+}
+
+// fetchToken requests a pull token from the token service named by the realm
+// of a bearer challenge.
+func (c *Client) fetchToken(ctx context.Context, ref imageref.Reference, params map[string]string, cred Credential, hasCred bool) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("%w: %s sent a bearer challenge without a valid realm", ErrUnauthorized, ref.Registry)
+	}
+
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + ref.Repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if hasCred {
+		req.SetBasicAuth(cred.Username, cred.Password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: token service %s returned %s", ErrUnauthorized, realm.Host, resp.Status)
+	}
+
+	tokenResponse := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return "", fmt.Errorf("unable to decode the token from %s: %w", realm.Host, err)
+	}
+
+	return cmp.Or(tokenResponse.Token, tokenResponse.AccessToken), nil
+}
+
+func basicAuth(cred Credential) string {
+	return base64.StdEncoding.EncodeToString([]byte(cred.Username + ":" + cred.Password))
+}
+
+// registryHost returns the host serving the registry API for registry.
+func registryHost(registry string) string {
+	if registry == imageref.DefaultRegistry {
+		return dockerHubHost
+	}
+
+	return registry
+}
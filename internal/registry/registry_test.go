@@ -0,0 +1,404 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/opdev/discover-workload/discovery"
+	"github.com/opdev/discover-workload/internal/imageref"
+)
+
+const (
+	testUsername = "user"
+	testPassword = "secret"
+	testToken    = "test-token"
+)
+
+// testRegistry is an in-process OCI Distribution registry, which serves
+// manifests and blobs to clients authenticated with a bearer token.
+type testRegistry struct {
+	server *httptest.Server
+
+	// manifests holds the manifests of each repository by tag and digest.
+	manifests map[string]map[string]testContent
+	blobs     map[string][]byte
+}
+
+type testContent struct {
+	mediaType string
+	content   []byte
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+	r := &testRegistry{manifests: map[string]map[string]testContent{}, blobs: map[string][]byte{}}
+	r.server = httptest.NewTLSServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+// newInsecureTestRegistry returns a testRegistry served over plain HTTP.
+func newInsecureTestRegistry(t *testing.T) *testRegistry {
+	t.Helper()
+	r := &testRegistry{manifests: map[string]map[string]testContent{}, blobs: map[string][]byte{}}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.server.Close)
+
+	return r
+}
+
+func (r *testRegistry) host() string {
+	return r.server.Listener.Addr().String()
+}
+
+func (r *testRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != testUsername || password != testPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"token": %q}`, testToken)
+		return
+	}
+
+	path, found := strings.CutPrefix(req.URL.Path, "/v2/")
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if req.Header.Get("Authorization") != "Bearer "+testToken {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if idx := strings.LastIndex(path, "/manifests/"); idx != -1 {
+		manifest, found := r.manifests[path[:idx]][path[idx+len("/manifests/"):]]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", manifest.mediaType)
+		w.Header().Set("Docker-Content-Digest", digestOf(manifest.content))
+		_, _ = w.Write(manifest.content)
+		return
+	}
+
+	if idx := strings.LastIndex(path, "/blobs/"); idx != -1 {
+		blob, found := r.blobs[path[idx+len("/blobs/"):]]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(blob)
+		return
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// pushImage stores a single-platform image in repository, and returns its
+// manifest digest.
+func (r *testRegistry) pushImage(t *testing.T, repository, tag, mediaType, os, arch string, labels map[string]string) string {
+	t.Helper()
+	config := mustMarshal(t, map[string]any{
+		"architecture": arch,
+		"os":           os,
+		"config":       map[string]any{"Labels": labels},
+	})
+	r.blobs[digestOf(config)] = config
+
+	manifest := mustMarshal(t, map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaType,
+		"config":        map[string]any{"digest": digestOf(config)},
+	})
+
+	return r.pushManifest(repository, tag, mediaType, manifest)
+}
+
+func (r *testRegistry) pushManifest(repository, tag, mediaType string, content []byte) string {
+	if r.manifests[repository] == nil {
+		r.manifests[repository] = map[string]testContent{}
+	}
+	digest := digestOf(content)
+	r.manifests[repository][digest] = testContent{mediaType: mediaType, content: content}
+	if tag != "" {
+		r.manifests[repository][tag] = testContent{mediaType: mediaType, content: content}
+	}
+
+	return digest
+}
+
+func digestOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	content, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return content
+}
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+	registry := newTestRegistry(t)
+	labels := map[string]string{"name": "org/app", "vendor": "Example", "version": "1.0", "release": "3", "summary": "An app", "build-date": "today"}
+
+	amd64 := registry.pushImage(t, "org/app", "", MediaTypeOCIManifest, "linux", "amd64", labels)
+	arm64 := registry.pushImage(t, "org/app", "", MediaTypeOCIManifest, "linux", "arm64", map[string]string{"name": "org/app-arm"})
+	index := mustMarshal(t, map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     MediaTypeOCIIndex,
+		"manifests": []any{
+			map[string]any{"digest": arm64, "platform": map[string]any{"os": "linux", "architecture": "arm64", "variant": "v8"}},
+			map[string]any{"digest": amd64, "platform": map[string]any{"os": "linux", "architecture": "amd64"}},
+			map[string]any{"digest": "sha256:attestation", "platform": map[string]any{"os": "unknown", "architecture": "unknown"}},
+		},
+	})
+	indexDigest := registry.pushManifest("org/app", "1.0", MediaTypeOCIIndex, index)
+	singleDigest := registry.pushImage(t, "org/single", "latest", MediaTypeDockerManifest, "linux", "s390x", nil)
+
+	keychain := Keychain{registry.host(): {Username: testUsername, Password: testPassword}}
+	client := NewClient(registry.server.Client(), keychain, nil)
+
+	expectedLabels := map[string]string{"name": "org/app", "vendor": "Example", "version": "1.0", "release": "3", "summary": "An app"}
+	testcases := map[string]struct {
+		image    string
+		expected discovery.ImageInspection
+	}{
+		"multi-arch index": {
+			image: registry.host() + "/org/app:1.0",
+			expected: discovery.ImageInspection{
+				Digest:    indexDigest,
+				MediaType: MediaTypeOCIIndex,
+				MultiArch: true,
+				Platforms: []string{"linux/arm64/v8", "linux/amd64"},
+				Labels:    expectedLabels,
+			},
+		},
+		"image by digest": {
+			image: registry.host() + "/org/app@" + amd64,
+			expected: discovery.ImageInspection{
+				Digest:    amd64,
+				MediaType: MediaTypeOCIManifest,
+				Platforms: []string{"linux/amd64"},
+				Labels:    expectedLabels,
+			},
+		},
+		"single-arch image without a tag": {
+			image: registry.host() + "/org/single",
+			expected: discovery.ImageInspection{
+				Digest:    singleDigest,
+				MediaType: MediaTypeDockerManifest,
+				Platforms: []string{"linux/s390x"},
+			},
+		},
+	}
+
+	for description, tc := range testcases {
+		t.Run(description, func(t *testing.T) {
+			t.Parallel()
+			actual, err := client.Inspect(context.TODO(), tc.image)
+			if err != nil {
+				t.Fatalf("Inspect returned an unexpected error: %q", err)
+			}
+
+			if actual.Digest != tc.expected.Digest ||
+				actual.MediaType != tc.expected.MediaType ||
+				actual.MultiArch != tc.expected.MultiArch ||
+				!slices.Equal(actual.Platforms, tc.expected.Platforms) ||
+				len(actual.Labels) != len(tc.expected.Labels) {
+				t.Fatalf("Inspect returned %+v; expected %+v", actual, tc.expected)
+			}
+			for key, value := range tc.expected.Labels {
+				if actual.Labels[key] != value {
+					t.Fatalf("Inspect returned labels %v; expected %v", actual.Labels, tc.expected.Labels)
+				}
+			}
+		})
+	}
+}
+
+func TestInspectInsecureRegistry(t *testing.T) {
+	t.Parallel()
+	registry := newInsecureTestRegistry(t)
+	digest := registry.pushImage(t, "org/app", "1.0", MediaTypeOCIManifest, "linux", "amd64", nil)
+	image := registry.host() + "/org/app:1.0"
+	keychain := Keychain{registry.host(): {Username: testUsername, Password: testPassword}}
+
+	// Registries are reached over HTTPS unless they are listed as insecure.
+	client := NewClient(registry.server.Client(), keychain, nil)
+	if _, err := client.Inspect(context.TODO(), image); err == nil {
+		t.Fatal("Inspect reached a plain HTTP registry which is not listed as insecure")
+	}
+
+	client = NewClient(registry.server.Client(), keychain, []string{registry.host()})
+	actual, err := client.Inspect(context.TODO(), image)
+	if err != nil {
+		t.Fatalf("Inspect returned an unexpected error: %q", err)
+	}
+	if actual.Digest != digest {
+		t.Fatalf("Inspect returned the digest %s; expected %s", actual.Digest, digest)
+	}
+}
+
+func TestEnrichRecordsErrors(t *testing.T) {
+	t.Parallel()
+	registry := newTestRegistry(t)
+	registry.pushImage(t, "org/app", "1.0", MediaTypeOCIManifest, "linux", "amd64", nil)
+
+	m := discovery.Manifest{DiscoveredImages: []discovery.DiscoveredImage{
+		{Image: registry.host() + "/org/app:1.0"},
+		{Image: registry.host() + "/org/app:1.0"},
+	}}
+
+	// Without credentials, the token service refuses to issue a token.
+	client := NewClient(registry.server.Client(), nil, nil)
+	_, err := client.Inspect(context.TODO(), m.DiscoveredImages[0].Image)
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Inspect returned %v; expected %v", err, ErrUnauthorized)
+	}
+
+	enriched := client.Enrich(context.TODO(), m, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for _, image := range enriched.DiscoveredImages {
+		if image.Inspection == nil || image.Inspection.Error == "" {
+			t.Fatalf("Enrich returned %+v; expected the error to be recorded", image.Inspection)
+		}
+	}
+	if m.DiscoveredImages[0].Inspection != nil {
+		t.Fatal("Enrich modified its input")
+	}
+}
+
+func TestKeychainFromSecrets(t *testing.T) {
+	t.Parallel()
+	auth := base64.StdEncoding.EncodeToString([]byte(testUsername + ":" + testPassword))
+	secrets := []*corev1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: "ns"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(`{"auths": {"https://index.docker.io/v1/": {"auth": "` + auth + `"}, "quay.io/my-org": {"username": "robot", "password": "token"}}}`),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "ns"},
+			Type:       corev1.SecretTypeDockercfg,
+			Data: map[string][]byte{
+				corev1.DockerConfigKey: []byte(`{"quay.io": {"auth": "` + auth + `"}}`),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "opaque", Namespace: "ns"},
+			Type:       corev1.SecretTypeOpaque,
+			Data:       map[string][]byte{"token": []byte("ignored")},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "unreferenced", Namespace: "ns"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(`{"auths": {"registry.example.com": {"auth": "` + auth + `"}}}`),
+			},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator", Namespace: "ns"},
+		Spec: corev1.PodSpec{
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "legacy"}, {Name: "missing"}},
+		},
+	}
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta:       metav1.ObjectMeta{Name: "default", Namespace: "ns"},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "pull-secret"}, {Name: "opaque"}},
+	}
+
+	client := fake.NewClientset(secrets[0], secrets[1], secrets[2], secrets[3], pod, serviceAccount)
+	keychain, err := KeychainFromSecrets(context.TODO(), client, []string{"ns"})
+	if err != nil {
+		t.Fatalf("KeychainFromSecrets returned an unexpected error: %q", err)
+	}
+
+	testcases := map[string]Credential{
+		"nginx":                     {Username: testUsername, Password: testPassword},
+		"quay.io/my-org/operator:1": {Username: "robot", Password: "token"},
+		"quay.io/other/operator:1":  {Username: testUsername, Password: testPassword},
+	}
+	for image, expected := range testcases {
+		ref, err := imageref.Parse(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual, found := keychain.Lookup(ref); !found || actual != expected {
+			t.Errorf("Lookup(%s) returned %v; expected %v", image, actual, expected)
+		}
+	}
+
+	ref, err := imageref.Parse("registry.example.com/org/operator:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, found := keychain.Lookup(ref); found {
+		t.Errorf("Lookup(%s) returned %v; expected the unreferenced secret to be ignored", ref, actual)
+	}
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	t.Parallel()
+	auth := base64.StdEncoding.EncodeToString([]byte(testUsername + ":" + testPassword))
+	testcases := map[string]struct {
+		content  string
+		expected Keychain
+	}{
+		"auths": {
+			content:  `{"auths": {"quay.io": {"auth": "` + auth + `"}}, "credsStore": "desktop"}`,
+			expected: Keychain{"quay.io": {Username: testUsername, Password: testPassword}},
+		},
+		"legacy": {
+			content:  `{"quay.io": {"auth": "` + auth + `"}}`,
+			expected: Keychain{"quay.io": {Username: testUsername, Password: testPassword}},
+		},
+		"credential helpers only": {
+			content:  `{"credsStore": "desktop", "credHelpers": {"gcr.io": "gcloud"}}`,
+			expected: Keychain{},
+		},
+	}
+
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			actual, err := ParseDockerConfig([]byte(tc.content))
+			if err != nil {
+				t.Fatalf("ParseDockerConfig returned an unexpected error: %q", err)
+			}
+			if !maps.Equal(actual, tc.expected) {
+				t.Errorf("ParseDockerConfig returned %v; expected %v", actual, tc.expected)
+			}
+		})
+	}
+}